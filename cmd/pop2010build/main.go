@@ -0,0 +1,276 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+// Command pop2010build -- builds the data files of the Pop2010 service (or of a census
+// vintage of the Pop service) from census block CSV.
+//
+// The input is a CSV file with a header row. The columns are located by name:
+//
+//	GEOID                   -- the census block ID
+//	INTPTLAT, INTPTLON      -- the internal point of the block (geographic latitude and longitude)
+//	P0120001,...,P0120049   -- table P12 (sex by age): the total population,
+//	                           the male population and 23 male age groups,
+//	                           the female population and 23 female age groups
+//
+// The P12 column names are those of the Census 2010; use -p12 P012%03d for the Census 2000
+// and -p12 P12_%03dN for the Census 2020. Other columns are ignored.
+//
+// Every block is checked: the coordinates must be valid, the counts must be non-negative,
+// the sexes must add up to the total, and the age groups must add up to the sex totals.
+// Blocks with zero population are skipped.
+//
+// The outputs are the geo file (id,pop,lat,lon,x,y,z, where x,y,z are the WGS1984
+// geocentric coordinates in meters rounded to integers), the Badger database of
+// block records, and optionally the same records as a flat file for svc.OpenCSVPopStore.
+//
+// Usage:
+//
+//	pop2010build -in blocks.csv [-geo nozgeo.txt] [-bddb ./bddb] [-csv records.csv] [-p12 P012%04d]
+//
+// The directory testdata/pop2010 holds a small fixture: blocks.csv (40 blocks around
+// Denver, CO) and the nozgeo.txt and records.csv built from it, so that the service
+// can be run end to end without census data.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/dgraph-io/badger"
+	"github.com/reconditematter/geomys"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// block -- a census block read from the input.
+type block struct {
+	id       string
+	lat, lon string
+	p12      [49]int
+	x, y, z  int
+}
+
+func main() {
+	in := flag.String("in", "", "the input census block CSV file")
+	geo := flag.String("geo", "nozgeo.txt", "the output geo file")
+	bddb := flag.String("bddb", "./bddb", "the output Badger directory")
+	csvout := flag.String("csv", "", "the output flat file of block records (optional)")
+	p12 := flag.String("p12", "P012%04d", "the format of the P12 column names")
+	flag.Parse()
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	//
+	blocks, skipped, err := readblocks(*in, *p12)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s: %d blocks, %d skipped with zero population", *in, len(blocks), skipped)
+	//
+	if err := writegeo(*geo, blocks); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s: written", *geo)
+	//
+	if err := writebddb(*bddb, blocks); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s: written", *bddb)
+	//
+	if *csvout != "" {
+		if err := writerecs(*csvout, blocks); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s: written", *csvout)
+	}
+}
+
+func readblocks(name, p12 string) (blocks []block, skipped int, err error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	rdr := csv.NewReader(bufio.NewReader(file))
+	//
+	header, err := rdr.Read()
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: header: %v", name, err)
+	}
+	col := make(map[string]int)
+	for k, h := range header {
+		col[strings.TrimSpace(h)] = k
+	}
+	colnames := []string{"GEOID", "INTPTLAT", "INTPTLON"}
+	for k := 1; k <= 49; k++ {
+		colnames = append(colnames, fmt.Sprintf(p12, k))
+	}
+	cols := make([]int, len(colnames))
+	for k, cn := range colnames {
+		c, ok := col[cn]
+		if !ok {
+			return nil, 0, fmt.Errorf("%s: missing column %s", name, cn)
+		}
+		cols[k] = c
+	}
+	//
+	geocen := geomys.NewGeocentric(geomys.WGS1984())
+	seen := make(map[string]bool)
+	for line := 2; ; line++ {
+		rec, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", name, err)
+		}
+		//
+		b, lat, lon, err := parseblock(rec, cols, colnames)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		if seen[b.id] {
+			return nil, 0, fmt.Errorf("%s:%d: repeated block %s", name, line, b.id)
+		}
+		seen[b.id] = true
+		if b.p12[0] == 0 {
+			skipped++
+			continue
+		}
+		//
+		xyz := geocen.Forward(geomys.Geo(lat, lon))
+		b.x, b.y, b.z = int(math.Round(xyz[0])), int(math.Round(xyz[1])), int(math.Round(xyz[2]))
+		blocks = append(blocks, b)
+	}
+	//
+	return blocks, skipped, nil
+}
+
+func parseblock(rec []string, cols []int, colnames []string) (b block, lat, lon float64, err error) {
+	b.id = strings.TrimSpace(rec[cols[0]])
+	if b.id == "" || strings.ContainsAny(b.id, ", ") {
+		return b, 0, 0, fmt.Errorf("invalid block id %q", b.id)
+	}
+	//
+	b.lat = strings.TrimSpace(rec[cols[1]])
+	lat, err = strconv.ParseFloat(b.lat, 64)
+	if err != nil || !(-90 <= lat && lat <= 90) {
+		return b, 0, 0, fmt.Errorf("block %s: invalid latitude %q", b.id, b.lat)
+	}
+	b.lon = strings.TrimSpace(rec[cols[2]])
+	lon, err = strconv.ParseFloat(b.lon, 64)
+	if err != nil || !(-180 <= lon && lon <= 180) {
+		return b, 0, 0, fmt.Errorf("block %s: invalid longitude %q", b.id, b.lon)
+	}
+	//
+	for k := range b.p12 {
+		s := strings.TrimSpace(rec[cols[k+3]])
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return b, 0, 0, fmt.Errorf("block %s: invalid count %q in %s", b.id, s, colnames[k+3])
+		}
+		b.p12[k] = n
+	}
+	//
+	if err := checkp12(b.p12); err != nil {
+		return b, 0, 0, fmt.Errorf("block %s: %v", b.id, err)
+	}
+	return b, lat, lon, nil
+}
+
+// checkp12 -- checks that table P12 adds up.
+func checkp12(p12 [49]int) error {
+	if p12[1]+p12[25] != p12[0] {
+		return errors.New("male and female populations do not add up to the total")
+	}
+	msum, fsum := 0, 0
+	for k := 0; k < 23; k++ {
+		msum += p12[k+2]
+		fsum += p12[k+26]
+	}
+	if msum != p12[1] {
+		return errors.New("male age groups do not add up to the male population")
+	}
+	if fsum != p12[25] {
+		return errors.New("female age groups do not add up to the female population")
+	}
+	return nil
+}
+
+// record -- returns the Badger record of `b`.
+func (b *block) record() string {
+	fields := make([]string, len(b.p12))
+	for k, n := range b.p12 {
+		fields[k] = strconv.Itoa(n)
+	}
+	return strings.Join(fields, ",")
+}
+
+func writegeo(name string, blocks []block) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	wtr := bufio.NewWriter(file)
+	for _, b := range blocks {
+		fmt.Fprintf(wtr, "%s,%d,%s,%s,%d,%d,%d\n", b.id, b.p12[0], b.lat, b.lon, b.x, b.y, b.z)
+	}
+	if err := wtr.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writerecs(name string, blocks []block) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	wtr := bufio.NewWriter(file)
+	for _, b := range blocks {
+		fmt.Fprintf(wtr, "%s,%s\n", b.id, b.record())
+	}
+	if err := wtr.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writebddb(dir string, blocks []block) error {
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLoggingLevel(2))
+	if err != nil {
+		return err
+	}
+	//
+	const batch = 1000
+	for lo := 0; lo < len(blocks); lo += batch {
+		hi := lo + batch
+		if hi > len(blocks) {
+			hi = len(blocks)
+		}
+		err := db.Update(func(txn *badger.Txn) error {
+			for k := lo; k < hi; k++ {
+				if err := txn.Set([]byte(blocks[k].id), []byte(blocks[k].record())); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return err
+		}
+	}
+	//
+	return db.Close()
+}
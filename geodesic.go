@@ -0,0 +1,646 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+//
+// Ported from GeographicLib (geodesic.c):
+// Copyright (c) Charles Karney (2012-2021) <charles@karney.com>.
+// Licensed under the MIT/X11 license.
+// See the NOTICE file for the GeographicLib license notice.
+
+package svc
+
+import (
+	"math"
+)
+
+// The geodesic on the ellipsoid by the algorithms of C. F. F. Karney,
+// Algorithms for geodesics, J. Geodesy 87, 43-55 (2013), with the series to the sixth order
+// in the third flattening. This is a port of the direct and inverse solutions of
+// GeographicLib (geodesic.c, MIT license); the results are accurate to about 15 nanometers.
+
+const (
+	gdord  = 6 // the order of the series
+	gdmax1 = 20
+	gdmax2 = gdmax1 + 53 + 10
+)
+
+var (
+	gdtiny = math.Sqrt(math.SmallestNonzeroFloat64 * (1 << 52)) // the square root of the smallest normal number
+	gdtol0 = math.Nextafter(1, 2) - 1
+	gdtol1 = 200 * gdtol0
+	gdtol2 = math.Sqrt(gdtol0)
+	gdtolb = gdtol0 * gdtol2
+	gdxthr = 1000 * gdtol2
+)
+
+// geodesic -- the geodesics of an ellipsoid of revolution.
+type geodesic struct {
+	a, f, f1, e2, ep2, n, b, etol2 float64
+	a3x                            [gdord]float64
+	c3x                            [gdord * (gdord - 1) / 2]float64
+}
+
+// wgsgeodesic -- the geodesics of WGS1984.
+var wgsgeodesic = newgeodesic(wgsA, wgsF)
+
+// newgeodesic -- the geodesics of the ellipsoid with the equatorial radius `a` and the flattening `f`.
+func newgeodesic(a, f float64) *geodesic {
+	g := &geodesic{a: a, f: f}
+	g.f1 = 1 - f
+	g.e2 = f * (2 - f)
+	g.ep2 = g.e2 / (g.f1 * g.f1)
+	g.n = f / (2 - f)
+	g.b = a * g.f1
+	g.etol2 = 0.1 * gdtol2 / math.Sqrt(math.Max(0.001, math.Abs(f))*math.Min(1, 1-f/2)/2)
+	// A3
+	a3 := []float64{-3, 128, -2, -3, 64, -1, -3, -1, 16, 3, -1, -2, 8, 1, -1, 2, 1, 1}
+	o, k := 0, 0
+	for j := gdord - 1; j >= 0; j-- {
+		m := imin(gdord-j-1, j)
+		g.a3x[k] = polyval(m, a3[o:], g.n) / a3[o+m+1]
+		k++
+		o += m + 2
+	}
+	// C3
+	c3 := []float64{
+		3, 128, 2, 5, 128, -1, 3, 3, 64, -1, 0, 1, 8, -1, 1, 4,
+		5, 256, 1, 3, 128, -3, -2, 3, 64, 1, -3, 2, 32,
+		7, 512, -10, 9, 384, 5, -9, 5, 192,
+		7, 512, -14, 7, 512,
+		21, 2560,
+	}
+	o, k = 0, 0
+	for l := 1; l < gdord; l++ {
+		for j := gdord - 1; j >= l; j-- {
+			m := imin(gdord-j-1, j)
+			g.c3x[k] = polyval(m, c3[o:], g.n) / c3[o+m+1]
+			k++
+			o += m + 2
+		}
+	}
+	return g
+}
+
+// inverse -- solves the inverse problem: returns the length of the geodesic
+// from (lat1,lon1) to (lat2,lon2) and its azimuths at the ends.
+func (g *geodesic) inverse(lat1, lon1, lat2, lon2 float64) (s12, azi1, azi2 float64) {
+	lon12, lon12s := angdiff(lon1, lon2)
+	// make the longitude difference positive
+	lonsign := 1.0
+	if lon12 < 0 {
+		lonsign = -1
+	}
+	lon12 = lonsign * anground(lon12)
+	lon12s = anground((180 - lon12) - lonsign*lon12s)
+	lam12 := lon12 * math.Pi / 180
+	var slam12, clam12 float64
+	if lon12 > 90 {
+		slam12, clam12 = sincosd(lon12s)
+		clam12 = -clam12
+	} else {
+		slam12, clam12 = sincosd(lon12)
+	}
+	// the point with the larger absolute latitude is the first one, and it is in the south
+	lat1, lat2 = anground(latfix(lat1)), anground(latfix(lat2))
+	swapp := 1.0
+	if math.Abs(lat1) < math.Abs(lat2) {
+		swapp = -1
+		lonsign = -lonsign
+		lat1, lat2 = lat2, lat1
+	}
+	latsign := 1.0
+	if lat1 >= 0 {
+		latsign = -1
+	}
+	lat1 *= latsign
+	lat2 *= latsign
+	//
+	sbet1, cbet1 := sincosd(lat1)
+	sbet1 *= g.f1
+	sbet1, cbet1 = norm2(sbet1, cbet1)
+	cbet1 = math.Max(gdtiny, cbet1)
+	sbet2, cbet2 := sincosd(lat2)
+	sbet2 *= g.f1
+	sbet2, cbet2 = norm2(sbet2, cbet2)
+	cbet2 = math.Max(gdtiny, cbet2)
+	if cbet1 < -sbet1 {
+		if cbet2 == cbet1 {
+			sbet2 = math.Copysign(sbet1, sbet2)
+		}
+	} else if math.Abs(sbet2) == -sbet1 {
+		cbet2 = cbet1
+	}
+	dn1 := math.Sqrt(1 + g.ep2*sbet1*sbet1)
+	dn2 := math.Sqrt(1 + g.ep2*sbet2*sbet2)
+	//
+	var s12x, sig12, salp1, calp1, salp2, calp2 float64
+	meridian := lat1 == -90 || slam12 == 0
+	if meridian {
+		// the geodesic may lie on a meridian
+		salp1, calp1 = slam12, clam12
+		salp2, calp2 = 0, 1
+		ssig1, csig1 := sbet1, calp1*cbet1
+		ssig2, csig2 := sbet2, calp2*cbet2
+		sig12 = math.Atan2(math.Max(0, csig1*ssig2-ssig1*csig2), csig1*csig2+ssig1*ssig2)
+		s12b, m12b := g.lengths(g.n, sig12, ssig1, csig1, dn1, ssig2, csig2, dn2)
+		if sig12 < 1 || m12b >= 0 {
+			if sig12 < 3*gdtiny || (sig12 < gdtol0 && (s12b < 0 || m12b < 0)) {
+				s12b = 0
+			}
+			s12x = s12b * g.b
+		} else {
+			meridian = false
+		}
+	}
+	if !meridian && sbet1 == 0 && (g.f <= 0 || lon12s >= g.f*180) {
+		// the geodesic runs along the equator
+		salp1, calp1, salp2, calp2 = 1, 0, 1, 0
+		s12x = g.a * lam12
+	} else if !meridian {
+		var dnm float64
+		sig12, salp1, calp1, salp2, calp2, dnm = g.inversestart(sbet1, cbet1, dn1, sbet2, cbet2, dn2, lam12, slam12, clam12)
+		if sig12 >= 0 {
+			// a short line
+			s12x = sig12 * g.b * dnm
+		} else {
+			// Newton's method on alp1 with a bracket of the root
+			var ssig1, csig1, ssig2, csig2, eps float64
+			salp1a, calp1a, salp1b, calp1b := gdtiny, 1.0, gdtiny, -1.0
+			tripn, tripb := false, false
+			for numit := 0; ; numit++ {
+				var v, dv float64
+				v, salp2, calp2, sig12, ssig1, csig1, ssig2, csig2, eps, dv = g.lambda12(sbet1, cbet1, dn1, sbet2, cbet2, dn2, salp1, calp1, slam12, clam12, numit < gdmax1)
+				tol := gdtol0
+				if tripn {
+					tol *= 8
+				}
+				if tripb || !(math.Abs(v) >= tol) || numit == gdmax2 {
+					break
+				}
+				if v > 0 && (numit > gdmax1 || calp1/salp1 > calp1b/salp1b) {
+					salp1b, calp1b = salp1, calp1
+				} else if v < 0 && (numit > gdmax1 || calp1/salp1 < calp1a/salp1a) {
+					salp1a, calp1a = salp1, calp1
+				}
+				if numit < gdmax1 && dv > 0 {
+					dalp1 := -v / dv
+					if math.Abs(dalp1) < math.Pi {
+						sdalp1, cdalp1 := math.Sincos(dalp1)
+						nsalp1 := salp1*cdalp1 + calp1*sdalp1
+						if nsalp1 > 0 {
+							calp1 = calp1*cdalp1 - salp1*sdalp1
+							salp1 = nsalp1
+							salp1, calp1 = norm2(salp1, calp1)
+							tripn = math.Abs(v) <= 16*gdtol0
+							continue
+						}
+					}
+				}
+				// bisect the bracket
+				salp1, calp1 = norm2((salp1a+salp1b)/2, (calp1a+calp1b)/2)
+				tripn = false
+				tripb = math.Abs(salp1a-salp1)+(calp1a-calp1) < gdtolb || math.Abs(salp1-salp1b)+(calp1-calp1b) < gdtolb
+			}
+			s12b, _ := g.lengths(eps, sig12, ssig1, csig1, dn1, ssig2, csig2, dn2)
+			s12x = s12b * g.b
+		}
+	}
+	//
+	if swapp < 0 {
+		salp1, salp2 = salp2, salp1
+		calp1, calp2 = calp2, calp1
+	}
+	salp1 *= swapp * lonsign
+	calp1 *= swapp * latsign
+	salp2 *= swapp * lonsign
+	calp2 *= swapp * latsign
+	return 0 + s12x, atan2d(salp1, calp1), atan2d(salp2, calp2)
+}
+
+// direct -- solves the direct problem: returns the point at the distance `s12`
+// from (lat1,lon1) along the geodesic with the azimuth `azi1`, and the azimuth there.
+func (g *geodesic) direct(lat1, lon1, azi1, s12 float64) (lat2, lon2, azi2 float64) {
+	salp1, calp1 := sincosd(anground(angnormalize(azi1)))
+	sbet1, cbet1 := sincosd(anground(latfix(lat1)))
+	sbet1 *= g.f1
+	sbet1, cbet1 = norm2(sbet1, cbet1)
+	cbet1 = math.Max(gdtiny, cbet1)
+	// the equatorial azimuth, and the arc length and the longitude on the auxiliary sphere from the node
+	salp0 := salp1 * cbet1
+	calp0 := math.Hypot(calp1, salp1*sbet1)
+	ssig1, somg1 := sbet1, salp0*sbet1
+	csig1 := 1.0
+	if sbet1 != 0 || calp1 != 0 {
+		csig1 = cbet1 * calp1
+	}
+	comg1 := csig1
+	ssig1, csig1 = norm2(ssig1, csig1)
+	k2 := calp0 * calp0 * g.ep2
+	eps := k2 / (2*(1+math.Sqrt(1+k2)) + k2)
+	//
+	a1m1 := a1m1f(eps)
+	var c1a, c1pa [gdord + 1]float64
+	c1f(eps, c1a[:])
+	c1pf(eps, c1pa[:])
+	b11 := sincosseries(ssig1, csig1, c1a[:], gdord)
+	s, c := math.Sincos(b11)
+	stau1, ctau1 := ssig1*c+csig1*s, csig1*c-ssig1*s
+	var c3a [gdord]float64
+	g.c3f(eps, c3a[:])
+	a3c := -g.f * salp0 * g.a3f(eps)
+	b31 := sincosseries(ssig1, csig1, c3a[:], gdord-1)
+	//
+	tau12 := s12 / (g.b * (1 + a1m1))
+	s, c = math.Sincos(tau12)
+	b12 := -sincosseries(stau1*c+ctau1*s, ctau1*c-stau1*s, c1pa[:], gdord)
+	sig12 := tau12 - (b12 - b11)
+	ssig12, csig12 := math.Sincos(sig12)
+	ssig2 := ssig1*csig12 + csig1*ssig12
+	csig2 := csig1*csig12 - ssig1*ssig12
+	sbet2 := calp0 * ssig2
+	cbet2 := math.Hypot(salp0, calp0*csig2)
+	if cbet2 == 0 {
+		cbet2, csig2 = gdtiny, gdtiny
+	}
+	salp2, calp2 := salp0, calp0*csig2
+	somg2, comg2 := salp0*ssig2, csig2
+	omg12 := math.Atan2(somg2*comg1-comg2*somg1, comg2*comg1+somg2*somg1)
+	lam12 := omg12 + a3c*(sig12+(sincosseries(ssig2, csig2, c3a[:], gdord-1)-b31))
+	lon2 = angnormalize(angnormalize(lon1) + angnormalize(lam12*180/math.Pi))
+	lat2 = atan2d(sbet2, g.f1*cbet2)
+	azi2 = atan2d(salp2, calp2)
+	return
+}
+
+// lengths -- returns the distance and the reduced length divided by `b`.
+func (g *geodesic) lengths(eps, sig12, ssig1, csig1, dn1, ssig2, csig2, dn2 float64) (s12b, m12b float64) {
+	var ca, cb [gdord + 1]float64
+	a1 := a1m1f(eps)
+	c1f(eps, ca[:])
+	a2 := a2m1f(eps)
+	c2f(eps, cb[:])
+	m0 := a1 - a2
+	a1, a2 = 1+a1, 1+a2
+	b1 := sincosseries(ssig2, csig2, ca[:], gdord) - sincosseries(ssig1, csig1, ca[:], gdord)
+	s12b = a1 * (sig12 + b1)
+	b2 := sincosseries(ssig2, csig2, cb[:], gdord) - sincosseries(ssig1, csig1, cb[:], gdord)
+	j12 := m0*sig12 + (a1*b1 - a2*b2)
+	m12b = dn2*(csig1*ssig2) - dn1*(ssig1*csig2) - csig1*csig2*j12
+	return
+}
+
+// inversestart -- returns a starting point of Newton's method for the inverse problem,
+// or the solution (sig12 >= 0) for a short line.
+func (g *geodesic) inversestart(sbet1, cbet1, dn1, sbet2, cbet2, dn2, lam12, slam12, clam12 float64) (sig12, salp1, calp1, salp2, calp2, dnm float64) {
+	sig12 = -1
+	sbet12 := sbet2*cbet1 - cbet2*sbet1
+	cbet12 := cbet2*cbet1 + sbet2*sbet1
+	sbet12a := sbet2*cbet1 + cbet2*sbet1
+	shortline := cbet12 >= 0 && sbet12 < 0.5 && cbet2*lam12 < 0.5
+	var somg12, comg12 float64
+	if shortline {
+		sbetm2 := (sbet1 + sbet2) * (sbet1 + sbet2)
+		sbetm2 /= sbetm2 + (cbet1+cbet2)*(cbet1+cbet2)
+		dnm = math.Sqrt(1 + g.ep2*sbetm2)
+		somg12, comg12 = math.Sincos(lam12 / (g.f1 * dnm))
+	} else {
+		somg12, comg12 = slam12, clam12
+	}
+	salp1 = cbet2 * somg12
+	if comg12 >= 0 {
+		calp1 = sbet12 + cbet2*sbet1*somg12*somg12/(1+comg12)
+	} else {
+		calp1 = sbet12a - cbet2*sbet1*somg12*somg12/(1-comg12)
+	}
+	ssig12 := math.Hypot(salp1, calp1)
+	csig12 := sbet1*sbet2 + cbet1*cbet2*comg12
+	//
+	if shortline && ssig12 < g.etol2 {
+		// a really short line
+		salp2 = cbet1 * somg12
+		if comg12 >= 0 {
+			calp2 = sbet12 - cbet1*sbet2*somg12*somg12/(1+comg12)
+		} else {
+			calp2 = sbet12 - cbet1*sbet2*(1-comg12)
+		}
+		salp2, calp2 = norm2(salp2, calp2)
+		sig12 = math.Atan2(ssig12, csig12)
+	} else if math.Abs(g.n) > 0.1 || csig12 >= 0 || ssig12 >= 6*math.Abs(g.n)*math.Pi*cbet1*cbet1 {
+		// the spherical approximation is good enough
+	} else {
+		// nearly antipodal points (the ellipsoid is oblate): solve the astroid problem
+		lam12x := math.Atan2(-slam12, -clam12)
+		k2 := sbet1 * sbet1 * g.ep2
+		eps := k2 / (2*(1+math.Sqrt(1+k2)) + k2)
+		lamscale := g.f * cbet1 * g.a3f(eps) * math.Pi
+		betscale := lamscale * cbet1
+		x := lam12x / lamscale
+		y := sbet12a / betscale
+		if y > -gdtol1 && x > -1-gdxthr {
+			salp1 = math.Min(1, -x)
+			calp1 = -math.Sqrt(1 - salp1*salp1)
+		} else {
+			k := astroid(x, y)
+			omg12a := lamscale * (-x * k / (1 + k))
+			somg12, comg12 = math.Sincos(omg12a)
+			comg12 = -comg12
+			salp1 = cbet2 * somg12
+			calp1 = sbet12a - cbet2*sbet1*somg12*somg12/(1-comg12)
+		}
+	}
+	if !(salp1 <= 0) {
+		salp1, calp1 = norm2(salp1, calp1)
+	} else {
+		salp1, calp1 = 1, 0
+	}
+	return
+}
+
+// lambda12 -- returns the longitude difference of the geodesic with the azimuth alp1
+// less the longitude difference lam120 of the ends, with the quantities of the geodesic
+// and the derivative by alp1 (if `diffp` is set).
+func (g *geodesic) lambda12(sbet1, cbet1, dn1, sbet2, cbet2, dn2, salp1, calp1, slam120, clam120 float64, diffp bool) (lam12, salp2, calp2, sig12, ssig1, csig1, ssig2, csig2, eps, dlam12 float64) {
+	if sbet1 == 0 && calp1 == 0 {
+		calp1 = -gdtiny
+	}
+	salp0 := salp1 * cbet1
+	calp0 := math.Hypot(calp1, salp1*sbet1)
+	ssig1, somg1 := sbet1, salp0*sbet1
+	csig1 = calp1 * cbet1
+	comg1 := csig1
+	ssig1, csig1 = norm2(ssig1, csig1)
+	if cbet2 != cbet1 {
+		salp2 = salp0 / cbet2
+	} else {
+		salp2 = salp1
+	}
+	if cbet2 != cbet1 || math.Abs(sbet2) != -sbet1 {
+		var t float64
+		if cbet1 < -sbet1 {
+			t = (cbet2 - cbet1) * (cbet1 + cbet2)
+		} else {
+			t = (sbet1 - sbet2) * (sbet1 + sbet2)
+		}
+		calp2 = math.Sqrt(calp1*cbet1*calp1*cbet1+t) / cbet2
+	} else {
+		calp2 = math.Abs(calp1)
+	}
+	ssig2, somg2 := sbet2, salp0*sbet2
+	csig2 = calp2 * cbet2
+	comg2 := csig2
+	ssig2, csig2 = norm2(ssig2, csig2)
+	sig12 = math.Atan2(math.Max(0, csig1*ssig2-ssig1*csig2), csig1*csig2+ssig1*ssig2)
+	somg12 := math.Max(0, comg1*somg2-somg1*comg2)
+	comg12 := comg1*comg2 + somg1*somg2
+	eta := math.Atan2(somg12*clam120-comg12*slam120, comg12*clam120+somg12*slam120)
+	k2 := calp0 * calp0 * g.ep2
+	eps = k2 / (2*(1+math.Sqrt(1+k2)) + k2)
+	var c3a [gdord]float64
+	g.c3f(eps, c3a[:])
+	b312 := sincosseries(ssig2, csig2, c3a[:], gdord-1) - sincosseries(ssig1, csig1, c3a[:], gdord-1)
+	lam12 = eta - g.f*g.a3f(eps)*salp0*(sig12+b312)
+	if diffp {
+		if calp2 == 0 {
+			dlam12 = -2 * g.f1 * dn1 / sbet1
+		} else {
+			_, dlam12 = g.lengths(eps, sig12, ssig1, csig1, dn1, ssig2, csig2, dn2)
+			dlam12 *= g.f1 / (calp2 * cbet2)
+		}
+	}
+	return
+}
+
+// astroid -- solves the astroid problem k^4+2k^3-(x^2+y^2-1)k^2-2y^2k-y^2 = 0 for the positive root.
+func astroid(x, y float64) float64 {
+	p, q := x*x, y*y
+	r := (p + q - 1) / 6
+	if q == 0 && r <= 0 {
+		return 0
+	}
+	S := p * q / 4
+	r2 := r * r
+	r3 := r * r2
+	disc := S * (S + 2*r3)
+	u := r
+	if disc >= 0 {
+		T3 := S + r3
+		if T3 < 0 {
+			T3 -= math.Sqrt(disc)
+		} else {
+			T3 += math.Sqrt(disc)
+		}
+		T := math.Cbrt(T3)
+		u += T
+		if T != 0 {
+			u += r2 / T
+		}
+	} else {
+		ang := math.Atan2(math.Sqrt(-disc), -(S + r3))
+		u += 2 * r * math.Cos(ang/3)
+	}
+	v := math.Sqrt(u*u + q)
+	var uv float64
+	if u < 0 {
+		uv = q / (v - u)
+	} else {
+		uv = u + v
+	}
+	w := (uv - q) / (2 * v)
+	return uv / (math.Sqrt(uv+w*w) + w)
+}
+
+// a3f -- the coefficient A3 of the longitude integral.
+func (g *geodesic) a3f(eps float64) float64 {
+	return polyval(gdord-1, g.a3x[:], eps)
+}
+
+// c3f -- the coefficients C3[l], l = 1,...,gdord-1, of the longitude integral.
+func (g *geodesic) c3f(eps float64, c []float64) {
+	mult, o := 1.0, 0
+	for l := 1; l < gdord; l++ {
+		m := gdord - l - 1
+		mult *= eps
+		c[l] = mult * polyval(m, g.c3x[o:], eps)
+		o += m + 1
+	}
+}
+
+// a1m1f -- the coefficient A1-1 of the distance integral.
+func a1m1f(eps float64) float64 {
+	coeff := []float64{1, 4, 64, 0, 256}
+	m := gdord / 2
+	t := polyval(m, coeff, eps*eps) / coeff[m+1]
+	return (t + eps) / (1 - eps)
+}
+
+// c1f -- the coefficients C1[l], l = 1,...,gdord, of the distance integral.
+func c1f(eps float64, c []float64) {
+	coeffseries(eps, c, []float64{-1, 6, -16, 32, -9, 64, -128, 2048, 9, -16, 768, 3, -5, 512, -7, 1280, -7, 2048})
+}
+
+// c1pf -- the coefficients C1'[l], l = 1,...,gdord, of the inverse of the distance integral.
+func c1pf(eps float64, c []float64) {
+	coeffseries(eps, c, []float64{205, -432, 768, 1536, 4005, -4736, 3840, 12288, -225, 116, 384, -7173, 2695, 7680, 3467, 7680, 38081, 61440})
+}
+
+// a2m1f -- the coefficient A2-1 of the reduced length integral.
+func a2m1f(eps float64) float64 {
+	coeff := []float64{-11, -28, -192, 0, 256}
+	m := gdord / 2
+	t := polyval(m, coeff, eps*eps) / coeff[m+1]
+	return (t - eps) / (1 + eps)
+}
+
+// c2f -- the coefficients C2[l], l = 1,...,gdord, of the reduced length integral.
+func c2f(eps float64, c []float64) {
+	coeffseries(eps, c, []float64{1, 2, 16, 32, 35, 64, 384, 2048, 15, 80, 768, 7, 35, 512, 63, 1280, 77, 2048})
+}
+
+// coeffseries -- evaluates c[l] = eps^l * (a polynomial in eps^2), l = 1,...,gdord, with the packed coefficients.
+func coeffseries(eps float64, c, coeff []float64) {
+	eps2, d, o := eps*eps, eps, 0
+	for l := 1; l <= gdord; l++ {
+		m := (gdord - l) / 2
+		c[l] = d * polyval(m, coeff[o:], eps2) / coeff[o+m+1]
+		o += m + 2
+		d *= eps
+	}
+}
+
+// sincosseries -- evaluates the sum of c[l]*sin(2*l*x), l = 1,...,n, by Clenshaw summation.
+func sincosseries(sinx, cosx float64, c []float64, n int) float64 {
+	ar := 2 * (cosx - sinx) * (cosx + sinx)
+	k := n + 1
+	var y0, y1 float64
+	if n&1 != 0 {
+		k--
+		y0 = c[k]
+	}
+	for n /= 2; n > 0; n-- {
+		k--
+		y1 = ar*y0 - y1 + c[k]
+		k--
+		y0 = ar*y1 - y0 + c[k]
+	}
+	return 2 * sinx * cosx * y0
+}
+
+// polyval -- evaluates the polynomial of the degree `n` with the coefficients `p` (highest first).
+func polyval(n int, p []float64, x float64) float64 {
+	if n < 0 {
+		return 0
+	}
+	y := p[0]
+	for k := 1; k <= n; k++ {
+		y = y*x + p[k]
+	}
+	return y
+}
+
+func imin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// norm2 -- scales (s,c) to the unit length.
+func norm2(s, c float64) (float64, float64) {
+	r := math.Hypot(s, c)
+	return s / r, c / r
+}
+
+// sumx -- the sum of `u` and `v`, and its rounding error.
+func sumx(u, v float64) (s, t float64) {
+	s = u + v
+	up := s - v
+	vpp := s - up
+	up -= u
+	vpp -= v
+	t = -(up + vpp)
+	return
+}
+
+// angnormalize -- reduces the angle `x` to (-180,180].
+func angnormalize(x float64) float64 {
+	x = math.Remainder(x, 360)
+	if x == -180 {
+		return 180
+	}
+	return x
+}
+
+// angdiff -- the difference y-x reduced to [-180,180], and its rounding error.
+func angdiff(x, y float64) (float64, float64) {
+	d, t := sumx(angnormalize(-x), angnormalize(y))
+	d = angnormalize(d)
+	if d == 180 && t > 0 {
+		d = -180
+	}
+	return sumx(d, t)
+}
+
+// anground -- rounds tiny angles, so that they are not much smaller than 1/16.
+func anground(x float64) float64 {
+	const z = 1.0 / 16
+	if x == 0 {
+		return 0
+	}
+	y := math.Abs(x)
+	if y < z {
+		y = z - (z - y)
+	}
+	return math.Copysign(y, x)
+}
+
+// latfix -- NaN for latitudes outside [-90,90].
+func latfix(x float64) float64 {
+	if math.Abs(x) > 90 {
+		return math.NaN()
+	}
+	return x
+}
+
+// sincosd -- the sine and the cosine of `x` degrees, exact for multiples of 90.
+func sincosd(x float64) (float64, float64) {
+	r := math.Mod(x, 360)
+	q := int(math.Round(r / 90))
+	r -= 90 * float64(q)
+	s, c := math.Sincos(r * math.Pi / 180)
+	switch q & 3 {
+	case 0:
+		return s + 0, c + 0
+	case 1:
+		return c + 0, -s + 0
+	case 2:
+		return -s + 0, -c + 0
+	}
+	return -c + 0, s + 0
+}
+
+// atan2d -- atan2(y,x) in degrees, in (-180,180], exact for the axes.
+func atan2d(y, x float64) float64 {
+	q := 0
+	if math.Abs(y) > math.Abs(x) {
+		x, y = y, x
+		q = 2
+	}
+	if x < 0 {
+		x = -x
+		q++
+	}
+	ang := math.Atan2(y, x) * 180 / math.Pi
+	switch q {
+	case 1:
+		if y >= 0 {
+			ang = 180 - ang
+		} else {
+			ang = -180 - ang
+		}
+	case 2:
+		ang = 90 - ang
+	case 3:
+		ang = -90 + ang
+	}
+	return ang
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGeodesicInverse(t *testing.T) {
+	tests := []struct {
+		lat1, lon1, lat2, lon2 float64
+		s12, azi1, azi2        float64
+	}{
+		// the example of Karney (2013), section 9
+		{-30, 0, 29.9, 179.8, 19989832.827610, 161.890524736, 18.090737246},
+		// the quarter meridian
+		{0, 0, 90, 0, 10001965.729313, 0, 0},
+		// antipodal points on the equator: the geodesic runs over a pole
+		{0, 0, 0, 180, 20003931.458625, 0, 180},
+		// along the equator
+		{0, 0, 0, 1, 111319.490793, 90, 90},
+	}
+	for _, tt := range tests {
+		s12, azi1, azi2 := wgsgeodesic.inverse(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+		if math.Abs(s12-tt.s12) > 1e-6 || math.Abs(azi1-tt.azi1) > 1e-9 || math.Abs(azi2-tt.azi2) > 1e-9 {
+			t.Errorf("(%v,%v)-(%v,%v): %.6f %.9f %.9f, expected %.6f %.9f %.9f", tt.lat1, tt.lon1, tt.lat2, tt.lon2, s12, azi1, azi2, tt.s12, tt.azi1, tt.azi2)
+		}
+	}
+}
+
+func TestGeodesicDirect(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		lat1 := math.Asin(2*rng.Float64()-1) * 180 / math.Pi
+		lat2 := math.Asin(2*rng.Float64()-1) * 180 / math.Pi
+		lon1, lon2 := 360*rng.Float64()-180, 360*rng.Float64()-180
+		if i%10 == 0 {
+			// nearly antipodal points
+			lat2, lon2 = -lat1+0.01*rng.Float64(), lon1+180-0.5*rng.Float64()
+		}
+		s12, azi1, azi2 := wgsgeodesic.inverse(lat1, lon1, lat2, lon2)
+		lat, lon, azi := wgsgeodesic.direct(lat1, lon1, azi1, s12)
+		if d, _, _ := wgsgeodesic.inverse(lat, lon, lat2, lon2); d > 1e-7 || math.Abs(math.Remainder(azi-azi2, 360)) > 1e-7 {
+			t.Fatalf("(%v,%v)-(%v,%v): the direct problem misses by %g m", lat1, lon1, lat2, lon2, d)
+		}
+	}
+}
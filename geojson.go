@@ -0,0 +1,160 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"errors"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// gjgeometry -- a GeoJSON (RFC 7946) geometry.
+type gjgeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// gjfeature -- a GeoJSON Feature.
+type gjfeature struct {
+	Type       string      `json:"type"`
+	Geometry   gjgeometry  `json:"geometry"`
+	Properties interface{} `json:"properties"`
+}
+
+// gjcollection -- a GeoJSON FeatureCollection.
+type gjcollection struct {
+	Type     string      `json:"type"`
+	Features []gjfeature `json:"features"`
+}
+
+// parsegeojson -- returns true if `r` asks for GeoJSON: by the query option ?format=geojson,
+// or by the header Accept: application/geo+json if the option is not given.
+func parsegeojson(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("format") {
+	case "geojson":
+		return true, nil
+	case "json":
+		return false, nil
+	case "":
+		for _, s := range strings.Split(r.Header.Get("Accept"), ",") {
+			mt, _, err := mime.ParseMediaType(s)
+			if err == nil && mt == "application/geo+json" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, errors.New("format must be json or geojson")
+}
+
+// gjpoint -- a Point.
+func gjpoint(p geolatlon) gjgeometry {
+	return gjgeometry{"Point", [2]float64{p.Lon, p.Lat}}
+}
+
+// gjmultipoint -- a MultiPoint.
+func gjmultipoint(ps []geolatlon) gjgeometry {
+	coords := make([][2]float64, len(ps))
+	for k, p := range ps {
+		coords[k] = [2]float64{p.Lon, p.Lat}
+	}
+	return gjgeometry{"MultiPoint", coords}
+}
+
+// gjline -- a LineString, or a MultiLineString if the line crosses the antimeridian (RFC 7946, 3.1.9).
+func gjline(ps []geolatlon) gjgeometry {
+	lines := gjsplit(ps)
+	if len(lines) == 1 {
+		if len(lines[0]) == 1 {
+			// a LineString has at least two positions
+			lines[0] = append(lines[0], lines[0][0])
+		}
+		return gjgeometry{"LineString", lines[0]}
+	}
+	return gjgeometry{"MultiLineString", lines}
+}
+
+// errgjring -- the ring crosses the antimeridian more than twice.
+var errgjring = errors.New("the ring crosses the antimeridian more than twice")
+
+// gjring -- a Polygon of the closed ring `ps`. A ring that crosses the antimeridian twice
+// is cut into a MultiPolygon; a ring around a pole is closed along the antimeridian and the pole.
+// The ring should be counterclockwise. A ring that crosses the antimeridian more than twice is an error.
+func gjring(ps []geolatlon) (gjgeometry, error) {
+	// start the ring off the antimeridian, so that a crossing at the first point is not missed
+	for k := 1; k < len(ps)-1; k++ {
+		if math.Abs(ps[k-1].Lon) != 180 {
+			break
+		}
+		if math.Abs(ps[k].Lon) != 180 {
+			ps = append(append(make([]geolatlon, 0, len(ps)), ps[k:len(ps)-1]...), ps[:k+1]...)
+			break
+		}
+	}
+	lines := gjsplit(ps)
+	switch len(lines) {
+	case 1:
+		return gjgeometry{"Polygon", [][][2]float64{lines[0]}}, nil
+	case 2:
+		// one crossing: the ring goes around a pole
+		ring := append(lines[1], lines[0][1:]...)
+		first, last := ring[0], ring[len(ring)-1]
+		// a counterclockwise ring crossing eastward has the north pole on its left
+		pole := 90.0
+		if last[0] < 0 {
+			pole = -90
+		}
+		ring = append(ring, [2]float64{last[0], pole}, [2]float64{first[0], pole}, first)
+		return gjgeometry{"Polygon", [][][2]float64{ring}}, nil
+	case 3:
+		// two crossings: the first and the last pieces are on the same side
+		ring1 := append(lines[2], lines[0][1:]...)
+		ring1 = append(ring1, ring1[0])
+		ring2 := append(lines[1], lines[1][0])
+		return gjgeometry{"MultiPolygon", [][][][2]float64{{ring1}, {ring2}}}, nil
+	}
+	return gjgeometry{}, errgjring
+}
+
+// gjsplit -- cuts the line `ps` where it crosses the antimeridian (the shorter way between two points).
+// The latitude of a crossing is interpolated linearly. A point on the antimeridian is kept
+// on the side of the point before it (the first point, on the side of the second one).
+func gjsplit(ps []geolatlon) [][][2]float64 {
+	lines := make([][][2]float64, 1, 2)
+	lines[0] = make([][2]float64, 0, len(ps))
+	// add -- appends the position `c` to the last line unless it repeats the last position
+	add := func(c [2]float64) {
+		line := lines[len(lines)-1]
+		if len(line) == 0 || line[len(line)-1] != c {
+			lines[len(lines)-1] = append(line, c)
+		}
+	}
+	prev := 0.0 // the longitude of the last position
+	for k, p := range ps {
+		lon := p.Lon
+		if k == 0 && math.Abs(lon) == 180 && len(ps) > 1 {
+			lon = math.Copysign(180, ps[1].Lon)
+		}
+		if k > 0 {
+			q := ps[k-1]
+			u := prev + math.Remainder(p.Lon-prev, 360)
+			if u > 180 || u < -180 {
+				b := math.Copysign(180, u)
+				lat := q.Lat + (p.Lat-q.Lat)*(b-prev)/(u-prev)
+				lat = math.Round(lat*1e8) / 1e8
+				add([2]float64{b, lat})
+				lines = append(lines, nil)
+				add([2]float64{-b, lat})
+			} else if math.Abs(lon) == 180 {
+				lon = math.Copysign(180, u)
+			}
+		}
+		add([2]float64{lon, p.Lat})
+		prev = lon
+	}
+	return lines
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// checkgjring -- checks that `ring` is a valid counterclockwise linear ring that does not cross the antimeridian.
+func checkgjring(t *testing.T, name string, ring [][2]float64) {
+	t.Helper()
+	n := len(ring)
+	if n < 4 || ring[0] != ring[n-1] {
+		t.Errorf("%s: the ring of %d positions is not closed", name, n)
+		return
+	}
+	area := 0.0
+	for k := 1; k < n; k++ {
+		a, b := ring[k-1], ring[k]
+		if math.Abs(a[0]) > 180 || math.Abs(a[1]) > 90 {
+			t.Errorf("%s: position %v", name, a)
+		}
+		// only the edge along a pole may span the map
+		if math.Abs(b[0]-a[0]) >= 180 && !(a[1] == b[1] && math.Abs(a[1]) == 90) {
+			t.Errorf("%s: the edge %v-%v crosses the antimeridian", name, a, b)
+		}
+		area += a[0]*b[1] - b[0]*a[1]
+	}
+	if area <= 0 {
+		t.Errorf("%s: the ring is not counterclockwise", name)
+	}
+}
+
+// gjcircle -- the counterclockwise ring of a circle, as in /api/geocircle.
+func gjcircle(lat, lon, radius float64) []geolatlon {
+	circle := gengeocircle(geonavs["greatellipse"], geomys.Geo(lat, lon), radius, 3)
+	ring := make([]geolatlon, len(circle))
+	for k, p := range circle {
+		lat, lon := p.Geo()
+		ring[len(ring)-1-k] = geolatlon{lat, lon}
+	}
+	return ring
+}
+
+func TestGJRing(t *testing.T) {
+	tests := []struct {
+		name  string
+		ring  []geolatlon
+		gtype string
+		pole  float64
+	}{
+		{"plain", gjcircle(10, 0, 100000), "Polygon", 0},
+		{"antimeridian", gjcircle(0, 179.5, 100000), "MultiPolygon", 0},
+		{"antimeridian west", gjcircle(-30, -179.8, 500000), "MultiPolygon", 0},
+		{"north pole", gjcircle(89, 0, 200000), "Polygon", 90},
+		{"south pole", gjcircle(-89, 120, 200000), "Polygon", -90},
+		// most of the ring is in the other hemisphere than the pole it goes around
+		{"large north", gjcircle(30, 0, 11100000), "Polygon", 90},
+		{"large south", gjcircle(-30, 60, 11100000), "Polygon", -90},
+	}
+	for _, tt := range tests {
+		g, err := gjring(tt.ring)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if g.Type != tt.gtype {
+			t.Errorf("%s: %s, expected %s", tt.name, g.Type, tt.gtype)
+			continue
+		}
+		switch coords := g.Coordinates.(type) {
+		case [][][2]float64:
+			if len(coords) != 1 {
+				t.Errorf("%s: %d rings", tt.name, len(coords))
+				continue
+			}
+			checkgjring(t, tt.name, coords[0])
+			// a ring around a pole is closed along the pole
+			atpole := 0
+			for _, c := range coords[0] {
+				if c[1] == tt.pole && math.Abs(c[0]) == 180 {
+					atpole++
+				}
+			}
+			if tt.pole != 0 && atpole != 2 {
+				t.Errorf("%s: %d positions at the pole", tt.name, atpole)
+			}
+		case [][][][2]float64:
+			if len(coords) != 2 {
+				t.Errorf("%s: %d polygons", tt.name, len(coords))
+				continue
+			}
+			for _, polygon := range coords {
+				checkgjring(t, tt.name, polygon[0])
+			}
+		default:
+			t.Errorf("%s: coordinates %T", tt.name, g.Coordinates)
+		}
+	}
+	// a ring that crosses the antimeridian four times
+	zigzag := []geolatlon{{0, 179}, {1, -179}, {2, 179}, {3, -179}, {4, 179}, {0, 179}}
+	if _, err := gjring(zigzag); err != errgjring {
+		t.Errorf("zigzag: %v", err)
+	}
+}
+
+func TestGJLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  []geolatlon
+		lines [][][2]float64
+	}{
+		{"plain", []geolatlon{{10, 10}, {20, 20}}, [][][2]float64{{{10, 10}, {20, 20}}}},
+		{"one point", []geolatlon{{10, 10}, {10, 10}}, [][][2]float64{{{10, 10}, {10, 10}}}},
+		{"eastward", []geolatlon{{10, 170}, {15, 179}, {17, -179}, {20, -170}},
+			[][][2]float64{{{170, 10}, {179, 15}, {180, 16}}, {{-180, 16}, {-179, 17}, {-170, 20}}}},
+		{"westward", []geolatlon{{20, -170}, {17, -179}, {15, 179}, {10, 170}},
+			[][][2]float64{{{-170, 20}, {-179, 17}, {-180, 16}}, {{180, 16}, {179, 15}, {170, 10}}}},
+		{"on the antimeridian", []geolatlon{{0, 179}, {1, -180}, {2, -179}},
+			[][][2]float64{{{179, 0}, {180, 1}}, {{-180, 1}, {-179, 2}}}},
+		{"starts on the antimeridian", []geolatlon{{0, 180}, {1, -179}},
+			[][][2]float64{{{-180, 0}, {-179, 1}}}},
+		{"there and back", []geolatlon{{0, 179}, {0, -179}, {2, 179}},
+			[][][2]float64{{{179, 0}, {180, 0}}, {{-180, 0}, {-179, 0}, {-180, 1}}, {{180, 1}, {179, 2}}}},
+	}
+	for _, tt := range tests {
+		g := gjline(tt.line)
+		var lines [][][2]float64
+		switch coords := g.Coordinates.(type) {
+		case [][2]float64:
+			lines = [][][2]float64{coords}
+		case [][][2]float64:
+			lines = coords
+		}
+		gtype := "LineString"
+		if len(tt.lines) > 1 {
+			gtype = "MultiLineString"
+		}
+		if g.Type != gtype || len(lines) != len(tt.lines) {
+			t.Errorf("%s: %s %v", tt.name, g.Type, g.Coordinates)
+			continue
+		}
+		for k := range lines {
+			if len(lines[k]) != len(tt.lines[k]) {
+				t.Errorf("%s: %v, expected %v", tt.name, lines, tt.lines)
+				break
+			}
+			for j := range lines[k] {
+				if lines[k][j] != tt.lines[k][j] {
+					t.Errorf("%s: %v, expected %v", tt.name, lines, tt.lines)
+				}
+			}
+		}
+	}
+}
+
+func TestGeoMatrixGeoJSON(t *testing.T) {
+	R := mux.NewRouter()
+	GeoMatrix(R)
+	body := `{"ids":["LHR","JFK","ANC","PKC"],"crd":[51.47,-0.46,40.64,-73.78,61.17,-150,53.17,158.45]}`
+	w := httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("POST", "/api/geomatrix/distances?format=geojson&method=geodesic", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var result struct {
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties jrep `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Features) != 6 {
+		t.Fatalf("%d features", len(result.Features))
+	}
+	nav := geonavs["geodesic"]
+	for _, f := range result.Features {
+		var lines [][][2]float64
+		if f.Geometry.Type == "LineString" {
+			var line [][2]float64
+			json.Unmarshal(f.Geometry.Coordinates, &line)
+			lines = [][][2]float64{line}
+		} else {
+			json.Unmarshal(f.Geometry.Coordinates, &lines)
+		}
+		name := f.Properties.From + "-" + f.Properties.To
+		if name == "ANC-PKC" && f.Geometry.Type != "MultiLineString" || name == "LHR-JFK" && f.Geometry.Type != "LineString" {
+			t.Errorf("%s: %s", name, f.Geometry.Type)
+		}
+		// the line follows the path: the pieces between the points are shorter than 200 km
+		// and add up to the distance
+		s := 0.0
+		n := 0
+		for _, line := range lines {
+			n += len(line)
+			for k := 1; k < len(line); k++ {
+				d, _, _ := nav.inverse(geomys.Geo(line[k-1][1], line[k-1][0]), geomys.Geo(line[k][1], line[k][0]))
+				if d > 200000 {
+					t.Errorf("%s: a piece of %.0f m", name, d)
+				}
+				s += d
+			}
+		}
+		if n <= 2 || math.Abs(s/1000-f.Properties.Km) > 0.1 {
+			t.Errorf("%s: %d positions, %.3f km, expected %.1f km", name, n, s/1000, f.Properties.Km)
+		}
+	}
+}
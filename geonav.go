@@ -0,0 +1,129 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"errors"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+)
+
+// geonav -- a method of solving the inverse and direct problems on WGS1984.
+// Distances are in meters, azimuths are in degrees clockwise from north;
+// `direct` returns the azimuth at the destination. `curve` is the type of the paths.
+type geonav struct {
+	name    string
+	curve   string
+	inverse func(p1, p2 geomys.Point) (s12, azi1, azi2 float64)
+	direct  func(p geomys.Point, azi, s float64) (geomys.Point, float64)
+}
+
+// geonavs -- the methods of the `method` option by name.
+var geonavs = map[string]geonav{
+	"greatellipse": greatellnav(),
+	"geodesic":     geodesicnav(),
+	"haversine":    haversinenav(),
+	"andoyer":      andoyernav(),
+}
+
+// defgeonav -- the method used when the `method` option is not given.
+const defgeonav = "greatellipse"
+
+// parsegeonav -- returns the method of `r` given by the query option ?method=<name>.
+func parsegeonav(r *http.Request) (geonav, error) {
+	name := r.URL.Query().Get("method")
+	if name == "" {
+		name = defgeonav
+	}
+	nav, ok := geonavs[name]
+	if !ok {
+		return geonav{}, errors.New("method must be greatellipse, geodesic, haversine or andoyer")
+	}
+	return nav, nil
+}
+
+// greatellnav -- the great ellipse.
+func greatellnav() geonav {
+	ell := geomys.NewGreatEllipse(geomys.WGS1984())
+	return geonav{"greatellipse", "GreatEllipse", ell.Inverse, ell.Direct}
+}
+
+// geodesicnav -- the ellipsoidal geodesic (Karney's algorithms, see geodesic.go).
+func geodesicnav() geonav {
+	inverse := func(p1, p2 geomys.Point) (s12, azi1, azi2 float64) {
+		lat1, lon1 := p1.Geo()
+		lat2, lon2 := p2.Geo()
+		return wgsgeodesic.inverse(lat1, lon1, lat2, lon2)
+	}
+	direct := func(p geomys.Point, azi, s float64) (geomys.Point, float64) {
+		lat1, lon1 := p.Geo()
+		lat2, lon2, azi2 := wgsgeodesic.direct(lat1, lon1, azi, s)
+		return geomys.Geo(lat2, lon2), azi2
+	}
+	return geonav{"geodesic", "Geodesic", inverse, direct}
+}
+
+// andoyernav -- the Andoyer-Lambert approximation of the geodesic distance.
+// The paths are geodesics: the azimuths are those of the geodesic, and `direct` finds
+// the point of the geodesic whose Andoyer-Lambert distance from the start is `s`,
+// so that the points placed along a path agree with the distance reported for it.
+func andoyernav() geonav {
+	spheroid := geomys.WGS1984()
+	gnav := geodesicnav()
+	inverse := func(p1, p2 geomys.Point) (s12, azi1, azi2 float64) {
+		_, azi1, azi2 = gnav.inverse(p1, p2)
+		return geomys.Andoyer(spheroid, p1, p2), azi1, azi2
+	}
+	direct := func(p geomys.Point, azi, s float64) (geomys.Point, float64) {
+		// the two distances differ by less than 0.1%, so the iteration
+		// t <- t - (andoyer(t) - s) converges fast
+		t := s
+		q, azi2 := gnav.direct(p, azi, t)
+		for i := 0; i < 10; i++ {
+			dt := geomys.Andoyer(spheroid, p, q) - s
+			if math.Abs(dt) < 1e-6 {
+				break
+			}
+			t -= dt
+			q, azi2 = gnav.direct(p, azi, t)
+		}
+		return q, azi2
+	}
+	return geonav{"andoyer", "Geodesic", inverse, direct}
+}
+
+// haversinenav -- the great circle on the sphere of the mean radius of WGS1984.
+func haversinenav() geonav {
+	const R = (2*wgsA + wgsB) / 3
+	const d2r = math.Pi / 180
+	inverse := func(p1, p2 geomys.Point) (s12, azi1, azi2 float64) {
+		lat1, lon1 := p1.Geo()
+		lat2, lon2 := p2.Geo()
+		φ1, φ2, Δλ := lat1*d2r, lat2*d2r, (lon2-lon1)*d2r
+		sφ1, cφ1 := math.Sincos(φ1)
+		sφ2, cφ2 := math.Sincos(φ2)
+		sΔλ, cΔλ := math.Sincos(Δλ)
+		sφ := math.Sin((φ2 - φ1) / 2)
+		sλ := math.Sin(Δλ / 2)
+		h := sφ*sφ + cφ1*cφ2*sλ*sλ
+		s12 = 2 * R * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+		azi1 = math.Atan2(sΔλ*cφ2, cφ1*sφ2-sφ1*cφ2*cΔλ) / d2r
+		azi2 = math.Atan2(sΔλ*cφ1, sφ2*cφ1*cΔλ-cφ2*sφ1) / d2r
+		return
+	}
+	direct := func(p geomys.Point, azi, s float64) (geomys.Point, float64) {
+		lat1, lon1 := p.Geo()
+		sφ1, cφ1 := math.Sincos(lat1 * d2r)
+		sα, cα := math.Sincos(azi * d2r)
+		sδ, cδ := math.Sincos(s / R)
+		sφ2 := sφ1*cδ + cφ1*sδ*cα
+		φ2 := math.Asin(math.Max(-1, math.Min(1, sφ2)))
+		Δλ := math.Atan2(sα*sδ*cφ1, cδ-sφ1*sφ2)
+		azi2 := math.Atan2(sα*cφ1, cφ1*cδ*cα-sφ1*sδ) / d2r
+		return geomys.Geo(φ2/d2r, math.Remainder(lon1+Δλ/d2r, 360)), azi2
+	}
+	return geonav{"haversine", "GreatCircle", inverse, direct}
+}
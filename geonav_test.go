@@ -0,0 +1,27 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"github.com/reconditematter/geomys"
+	"math"
+	"testing"
+)
+
+func TestGeoNavDirect(t *testing.T) {
+	p1, p2 := geomys.Geo(40.64, -73.78), geomys.Geo(1.36, 103.99)
+	for name, nav := range geonavs {
+		s12, azi1, azi2 := nav.inverse(p1, p2)
+		// the direct problem reaches the target and agrees with the distance of the method at the midpoint
+		q, azi := nav.direct(p1, azi1, s12)
+		if d, _, _ := geonavs["geodesic"].inverse(q, p2); d > 0.01 || math.Abs(math.Remainder(azi-azi2, 360)) > 1e-6 {
+			t.Errorf("%s: the target is missed by %g m", name, d)
+		}
+		m, _ := nav.direct(p1, azi1, s12/2)
+		if s, _, _ := nav.inverse(p1, m); math.Abs(s-s12/2) > 0.01 {
+			t.Errorf("%s: the midpoint is at %.3f m, expected %.3f m", name, s, s12/2)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"math"
+)
+
+// WGS1984 parameters
+const (
+	wgsA  = 6378137.0
+	wgsF  = 1 / 298.257223563
+	wgsB  = wgsA * (1 - wgsF)
+	wgsE2 = wgsF * (2 - wgsF)
+)
+
+// ecefgeo -- returns the geographic latitude and longitude of the geocentric point `xyz`
+// (Bowring's method, two iterations).
+func ecefgeo(xyz [3]float64) (lat, lon float64) {
+	x, y, z := xyz[0], xyz[1], xyz[2]
+	ep2 := wgsE2 / (1 - wgsE2)
+	p := math.Hypot(x, y)
+	lon = math.Atan2(y, x)
+	θ := math.Atan2(z*wgsA, p*wgsB)
+	var φ float64
+	for i := 0; i < 2; i++ {
+		s, c := math.Sincos(θ)
+		φ = math.Atan2(z+ep2*wgsB*s*s*s, p-wgsE2*wgsA*c*c*c)
+		θ = math.Atan((1 - wgsF) * math.Tan(φ))
+	}
+	return φ * 180 / math.Pi, lon * 180 / math.Pi
+}
+
+// dot3 -- the dot product of the vectors `a` and `b`.
+func dot3(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+// cross3 -- the cross product of the vectors `a` and `b`.
+func cross3(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+// norm3 -- the length of the vector `a`.
+func norm3(a [3]float64) float64 {
+	return math.Sqrt(dot3(a, a))
+}
+
+// unit3 -- the vector `a` scaled to the unit length.
+func unit3(a [3]float64) [3]float64 {
+	n := norm3(a)
+	return [3]float64{a[0] / n, a[1] / n, a[2] / n}
+}
+
+// goldenmin -- minimizes the unimodal function `f` on [a,b] by the golden-section search
+// until the interval is shorter than `tol`. Returns the minimizer and the minimum.
+func goldenmin(f func(x float64) float64, a, b, tol float64) (float64, float64) {
+	const invphi = 0.6180339887498949
+	c := b - invphi*(b-a)
+	d := a + invphi*(b-a)
+	fc, fd := f(c), f(d)
+	for b-a > tol {
+		if fc < fd {
+			b, d, fd = d, c, fc
+			c = b - invphi*(b-a)
+			fc = f(c)
+		} else {
+			a, c, fc = c, d, fd
+			d = a + invphi*(b-a)
+			fd = f(d)
+		}
+	}
+	x := (a + b) / 2
+	return x, f(x)
+}
+
+// geolatlon -- a geographic location in the input or the output of the services.
+type geolatlon struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
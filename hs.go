@@ -52,3 +52,30 @@ func HS200t(w http.ResponseWriter, b []byte) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(b)
 }
+
+// HS200geojson -- returns 200 status code and writes `b` as GeoJSON.
+func HS200geojson(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache,no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// HS200png -- returns 200 status code and writes `b` as a PNG image.
+func HS200png(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache,no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// HS409t -- returns 409 status code with an error message.
+func HS409t(w http.ResponseWriter, errmsg string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache,no-store")
+	w.WriteHeader(http.StatusConflict)
+	w.Write([]byte("409 Conflict: " + errmsg))
+}
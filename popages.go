@@ -0,0 +1,165 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// popageband -- a named group of the consecutive age buckets from lo to hi (indices).
+type popageband struct {
+	name   string
+	lo, hi int
+}
+
+// popageopts -- the age options of a request: ?ages=<bands>&raw=<true|false>.
+// The population by age is reported in the age buckets of the census (raw),
+// in the age bands, or in both.
+type popageopts struct {
+	bands []popageband
+	raw   bool
+}
+
+// popageband1 -- a custom age band: [name:]lo-hi, [name:]lo- or [name:]age.
+var popageband1 = regexp.MustCompile(`^(?:([A-Za-z_][A-Za-z0-9_]*):)?([0-9]+)(?:(-)([0-9]*))?$`)
+
+// popagestep -- age bands of the same width: 5y, 10y, ...
+var popagestep = regexp.MustCompile(`^([0-9]+)y$`)
+
+// parseageopts -- parses the age options of `r` for the age buckets `ages`.
+func parseageopts(r *http.Request, ages []PopAgeBucket) (popageopts, error) {
+	opts := popageopts{raw: true}
+	q := r.URL.Query()
+	if s := q.Get("raw"); s != "" {
+		raw, err := strconv.ParseBool(s)
+		if err != nil {
+			return opts, errors.New("raw must be true or false")
+		}
+		opts.raw = raw
+	}
+	if s := q.Get("ages"); s != "" {
+		bands, err := parseagebands(s, ages)
+		if err != nil {
+			return opts, err
+		}
+		opts.bands = bands
+	}
+	return opts, nil
+}
+
+// parseagebands -- parses the age bands `spec` and maps them to the age buckets `ages`.
+// The spec is either Ny (the bands of N years, the last one open-ended)
+// or comma-separated bands, e.g. children:0-17,adults:18-64,seniors:65-.
+// The bands must increase and start and end at the bucket boundaries.
+func parseagebands(spec string, ages []PopAgeBucket) ([]popageband, error) {
+	const NMAX = 50
+	//
+	type span struct {
+		name   string
+		lo, hi int // hi is -1 if open-ended
+	}
+	spans := make([]span, 0)
+	if m := popagestep.FindStringSubmatch(spec); m != nil {
+		step, err := strconv.Atoi(m[1])
+		if err != nil || !(1 <= step && step <= 100) {
+			return nil, errors.New("age band width must be in [1,100]")
+		}
+		// the open-ended band starts where the open-ended bucket
+		// (or the bucket after the last one) can be reached in whole steps
+		last := ages[len(ages)-1]
+		top := last.Lo
+		if last.Hi >= 0 {
+			top = last.Hi + 1
+		}
+		for lo := 0; lo+step <= top; lo += step {
+			spans = append(spans, span{"", lo, lo + step - 1})
+		}
+		if last.Hi < 0 {
+			spans = append(spans, span{"", len(spans) * step, -1})
+		}
+	} else {
+		for _, f := range strings.Split(spec, ",") {
+			m := popageband1.FindStringSubmatch(f)
+			if m == nil {
+				return nil, fmt.Errorf("invalid age band %q", f)
+			}
+			lo, err := strconv.Atoi(m[2])
+			if err != nil || lo > 200 {
+				return nil, fmt.Errorf("invalid age band %q", f)
+			}
+			hi := lo
+			if m[3] != "" {
+				hi = -1
+				if m[4] != "" {
+					hi, err = strconv.Atoi(m[4])
+					if err != nil || hi < lo || hi > 200 {
+						return nil, fmt.Errorf("invalid age band %q", f)
+					}
+				}
+			}
+			spans = append(spans, span{m[1], lo, hi})
+		}
+	}
+	if len(spans) > NMAX {
+		return nil, errors.New("too many age bands")
+	}
+	//
+	bands := make([]popageband, len(spans))
+	names := make(map[string]bool)
+	next := 0
+	for i, s := range spans {
+		if s.lo < next {
+			return nil, errors.New("age bands must increase")
+		}
+		b := popageband{s.name, -1, -1}
+		if b.name == "" {
+			b.name = agelabel(PopAgeBucket{s.lo, s.hi})
+		}
+		if names[b.name] {
+			return nil, fmt.Errorf("repeated age band %s", b.name)
+		}
+		names[b.name] = true
+		for k, a := range ages {
+			if a.Lo == s.lo {
+				b.lo = k
+			}
+			if a.Hi == s.hi {
+				b.hi = k
+			}
+		}
+		if b.lo < 0 || b.hi < 0 {
+			return nil, fmt.Errorf("age band %s does not match the census age groups", b.name)
+		}
+		bands[i] = b
+		if s.hi < 0 {
+			if i != len(spans)-1 {
+				return nil, errors.New("only the last age band can be open-ended")
+			}
+			break
+		}
+		next = s.hi + 1
+	}
+	return bands, nil
+}
+
+// mkagebands -- sums up the counts of the age buckets in every age band.
+func mkagebands(bands []popageband, counts []int) []popagecount {
+	if len(bands) == 0 {
+		return nil
+	}
+	result := make([]popagecount, len(bands))
+	for i, b := range bands {
+		result[i].Age = b.name
+		for k := b.lo; k <= b.hi; k++ {
+			result[i].Count += counts[k]
+		}
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseAgeBands(t *testing.T) {
+	// ages -- the ages lo-hi (or lo- if open-ended) of every band
+	ages := func(n, step int) [][2]int {
+		spans := make([][2]int, n)
+		for k := range spans {
+			spans[k] = [2]int{k * step, k*step + step - 1}
+		}
+		spans[n-1][1] = -1
+		return spans
+	}
+	tests := []struct {
+		spec  string
+		names string
+		ages  [][2]int
+	}{
+		{"5y", "under5,5to9,10to14,15to19,20to24,25to29,30to34,35to39,40to44,45to49,50to54,55to59,60to64,65to69,70to74,75to79,80to84,85over", ages(18, 5)},
+		{"10y", "under10,10to19,20to29,30to39,40to49,50to59,60to69,70to79,80over", ages(9, 10)},
+		{"children:0-17,adults:18-64,seniors:65-", "children,adults,seniors", [][2]int{{0, 17}, {18, 64}, {65, -1}}},
+		{"20", "20", [][2]int{{20, 20}}},
+		{"young:18-24,85-", "young,85over", [][2]int{{18, 24}, {85, -1}}},
+	}
+	// the male counts of the first block of testdata/pop2010, by the P12 age buckets
+	rec := strings.Split("276,149,10,8,7,7,4,3,3,8,12,3,4,9,8,6,7,2,9,10,7,4,12,3,3,127,9,0,4,10,6,3,12,10,12,8,3,2,9,5,6,12,4,1,2,1,1,7,0", ",")
+	counts := make([]int, len(PopAgesP12))
+	for k := range counts {
+		counts[k], _ = strconv.Atoi(rec[k+2])
+	}
+	for _, tt := range tests {
+		bands, err := parseagebands(tt.spec, PopAgesP12)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		names := make([]string, len(bands))
+		for i, b := range bands {
+			names[i] = b.name
+		}
+		if strings.Join(names, ",") != tt.names || len(bands) != len(tt.ages) {
+			t.Errorf("%s: bands %v, expected %s", tt.spec, names, tt.names)
+			continue
+		}
+		// every band sums up the P12 buckets that lie within its ages
+		for i, c := range mkagebands(bands, counts) {
+			lo, hi := tt.ages[i][0], tt.ages[i][1]
+			if PopAgesP12[bands[i].lo].Lo != lo || PopAgesP12[bands[i].hi].Hi != hi {
+				t.Errorf("%s: band %s has the buckets %d-%d", tt.spec, c.Age, bands[i].lo, bands[i].hi)
+			}
+			sum := 0
+			for k, a := range PopAgesP12 {
+				if lo <= a.Lo && (hi < 0 || 0 <= a.Hi && a.Hi <= hi) {
+					sum += counts[k]
+				}
+			}
+			if c.Age != bands[i].name || c.Count != sum {
+				t.Errorf("%s: band %s counts %d, expected %d", tt.spec, c.Age, c.Count, sum)
+			}
+		}
+	}
+	//
+	errtests := []struct {
+		spec    string
+		errtext string
+	}{
+		{"0-2", "does not match the census age groups"},
+		{"18-64,0-17", "must increase"},
+		{"0-17,10-20", "must increase"},
+		{"65-,0-4", "only the last age band can be open-ended"},
+		{"a:0-4,a:5-9", "repeated age band a"},
+		{"0-4,under5:5-9", "repeated age band under5"},
+		{"1y", "too many age bands"},
+		{"0y", "width must be in [1,100]"},
+		{"kids:", "invalid age band"},
+		{"0-17,", "invalid age band"},
+		{"10-5", "invalid age band"},
+	}
+	for _, tt := range errtests {
+		_, err := parseagebands(tt.spec, PopAgesP12)
+		if err == nil || !strings.Contains(err.Error(), tt.errtext) {
+			t.Errorf("%s: error %v, expected %q", tt.spec, err, tt.errtext)
+		}
+	}
+}
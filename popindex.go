@@ -0,0 +1,164 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"github.com/reconditematter/geomys"
+	"math"
+	"sort"
+)
+
+// popindex -- a k-d tree over the geocentric coordinates of census blocks.
+//
+// The tree is implicit: `perm` is a permutation of the indices of `locs`
+// such that for every subrange [lo,hi) the median element perm[(lo+hi)/2]
+// splits the subrange by the coordinate depth%3 (x, y, z).
+type popindex struct {
+	locs []poploc
+	perm []int
+}
+
+// newpopindex -- builds the index for `locs`.
+func newpopindex(locs []poploc) *popindex {
+	perm := make([]int, len(locs))
+	for k := range perm {
+		perm[k] = k
+	}
+	idx := &popindex{locs, perm}
+	idx.build(0, len(perm), 0)
+	return idx
+}
+
+// xyz -- returns the geocentric coordinate `axis` (0=x, 1=y, 2=z) of `loc`.
+func (loc *poploc) xyz(axis int) int {
+	switch axis {
+	case 0:
+		return loc.x
+	case 1:
+		return loc.y
+	}
+	return loc.z
+}
+
+func (idx *popindex) coord(k, axis int) int {
+	return idx.locs[idx.perm[k]].xyz(axis)
+}
+
+func (idx *popindex) build(lo, hi, depth int) {
+	if hi-lo < 2 {
+		return
+	}
+	axis := depth % 3
+	mid := (lo + hi) / 2
+	idx.selectk(lo, hi, mid, axis)
+	idx.build(lo, mid, depth+1)
+	idx.build(mid+1, hi, depth+1)
+}
+
+// selectk -- rearranges perm[lo:hi] so that perm[k] is in its sorted position
+// by the coordinate `axis`, smaller coordinates before it, larger after it.
+func (idx *popindex) selectk(lo, hi, k, axis int) {
+	perm := idx.perm
+	for hi-lo > 1 {
+		// median of three
+		a, b, c := lo, (lo+hi)/2, hi-1
+		if idx.coord(b, axis) < idx.coord(a, axis) {
+			perm[a], perm[b] = perm[b], perm[a]
+		}
+		if idx.coord(c, axis) < idx.coord(a, axis) {
+			perm[a], perm[c] = perm[c], perm[a]
+		}
+		if idx.coord(c, axis) < idx.coord(b, axis) {
+			perm[b], perm[c] = perm[c], perm[b]
+		}
+		perm[b], perm[c] = perm[c], perm[b]
+		pivot := idx.coord(c, axis)
+		//
+		p := lo
+		for i := lo; i < c; i++ {
+			if idx.coord(i, axis) < pivot {
+				perm[i], perm[p] = perm[p], perm[i]
+				p++
+			}
+		}
+		perm[p], perm[c] = perm[c], perm[p]
+		//
+		switch {
+		case k < p:
+			hi = p
+		case k > p:
+			lo = p + 1
+		default:
+			return
+		}
+	}
+}
+
+// within -- calls `visit` for every block whose Andoyer distance from `query`
+// does not exceed `dist`. The index `k` refers to `idx.locs`, `d` is the distance.
+func (idx *popindex) within(query geomys.Point, dist float64, visit func(k int, d float64)) {
+	spheroid := geomys.WGS1984()
+	geocen := geomys.NewGeocentric(spheroid)
+	xyz := geocen.Forward(query)
+	bmin := [3]int{round(xyz[0] - dist), round(xyz[1] - dist), round(xyz[2] - dist)}
+	bmax := [3]int{round(xyz[0] + dist), round(xyz[1] + dist), round(xyz[2] + dist)}
+	//
+	var search func(lo, hi, depth int)
+	search = func(lo, hi, depth int) {
+		if lo >= hi {
+			return
+		}
+		axis := depth % 3
+		mid := (lo + hi) / 2
+		k := idx.perm[mid]
+		loc := &idx.locs[k]
+		if bmin[0] <= loc.x && loc.x <= bmax[0] && bmin[1] <= loc.y && loc.y <= bmax[1] && bmin[2] <= loc.z && loc.z <= bmax[2] {
+			d := geomys.Andoyer(spheroid, query, geomys.Geo(loc.lat, loc.lon))
+			if d <= dist {
+				visit(k, d)
+			}
+		}
+		//
+		c := loc.xyz(axis)
+		if bmin[axis] <= c {
+			search(lo, mid, depth+1)
+		}
+		if c <= bmax[axis] {
+			search(mid+1, hi, depth+1)
+		}
+	}
+	search(0, len(idx.perm), 0)
+}
+
+// popnear -- a block found near a location: the index in `locs` and the distance.
+type popnear struct {
+	k int
+	d float64
+}
+
+// nearest -- returns the blocks within `dmax` of `query` ordered by distance,
+// searching a growing radius and stopping as soon as `enough` is satisfied
+// by the blocks found so far. All blocks closer than the last one returned
+// are included, so every prefix of the result is exact.
+func (idx *popindex) nearest(query geomys.Point, dmax float64, enough func(ns []popnear) bool) []popnear {
+	var ns []popnear
+	for dist := math.Min(1000, dmax); ; dist = math.Min(2*dist, dmax) {
+		ns = ns[:0]
+		idx.within(query, dist, func(k int, d float64) {
+			ns = append(ns, popnear{k, d})
+		})
+		if dist == dmax || enough(ns) {
+			break
+		}
+	}
+	//
+	sort.Slice(ns, func(i, j int) bool {
+		if ns[i].d != ns[j].d {
+			return ns[i].d < ns[j].d
+		}
+		return ns[i].k < ns[j].k
+	})
+	return ns
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"github.com/reconditematter/geomys"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// synthpoplocs -- `n` blocks spread uniformly over the globe.
+func synthpoplocs(n int, seed int64) []poploc {
+	rng := rand.New(rand.NewSource(seed))
+	geocen := geomys.NewGeocentric(geomys.WGS1984())
+	locs := make([]poploc, n)
+	for k := range locs {
+		lat := math.Asin(2*rng.Float64()-1) * 180 / math.Pi
+		lon := 360*rng.Float64() - 180
+		xyz := geocen.Forward(geomys.Geo(lat, lon))
+		locs[k] = poploc{strconv.Itoa(k), 1 + rng.Intn(100), lat, lon, round(xyz[0]), round(xyz[1]), round(xyz[2])}
+	}
+	return locs
+}
+
+// linearwithin -- the blocks within `dist` of `query` found by the linear scan.
+func linearwithin(locs []poploc, query geomys.Point, dist float64) []int {
+	spheroid := geomys.WGS1984()
+	ks := make([]int, 0)
+	for k := range locs {
+		if geomys.Andoyer(spheroid, query, geomys.Geo(locs[k].lat, locs[k].lon)) <= dist {
+			ks = append(ks, k)
+		}
+	}
+	return ks
+}
+
+// indexwithin -- the blocks within `dist` of `query` found by the index, in order.
+func indexwithin(idx *popindex, query geomys.Point, dist float64) []int {
+	ks := make([]int, 0)
+	idx.within(query, dist, func(k int, d float64) {
+		ks = append(ks, k)
+	})
+	sort.Ints(ks)
+	return ks
+}
+
+func TestPopIndexWithin(t *testing.T) {
+	locs := synthpoplocs(50000, 1)
+	idx := newpopindex(locs)
+	rng := rand.New(rand.NewSource(2))
+	queries := []geomys.Point{
+		geomys.Geo(0, 180), geomys.Geo(0, -180), geomys.Geo(45, 179.9), geomys.Geo(-45, -179.9),
+		geomys.Geo(90, 0), geomys.Geo(-90, 0), geomys.Geo(89.9, 135), geomys.Geo(-89.9, -45),
+	}
+	for i := 0; i < 40; i++ {
+		queries = append(queries, geomys.Geo(math.Asin(2*rng.Float64()-1)*180/math.Pi, 360*rng.Float64()-180))
+	}
+	for _, q := range queries {
+		for _, dist := range []float64{10000, 100000, 500000, 2000000} {
+			a := indexwithin(idx, q, dist)
+			b := linearwithin(locs, q, dist)
+			if len(a) != len(b) {
+				lat, lon := q.Geo()
+				t.Fatalf("(%v,%v) %v: index %d blocks, linear scan %d blocks", lat, lon, dist, len(a), len(b))
+			}
+			for j := range a {
+				if a[j] != b[j] {
+					lat, lon := q.Geo()
+					t.Fatalf("(%v,%v) %v: index and linear scan differ", lat, lon, dist)
+				}
+			}
+		}
+	}
+}
+
+func TestPopIndexNearest(t *testing.T) {
+	locs := synthpoplocs(20000, 3)
+	idx := newpopindex(locs)
+	q := geomys.Geo(0, 179.95)
+	ns := idx.nearest(q, 1000000, func(ns []popnear) bool { return len(ns) >= 10 })
+	if len(ns) < 10 {
+		t.Fatalf("nearest: %d blocks", len(ns))
+	}
+	// no block outside the result is closer than the last one returned
+	all := linearwithin(locs, q, ns[len(ns)-1].d)
+	if len(all) != len(ns) {
+		t.Fatalf("nearest: %d blocks, linear scan %d blocks", len(ns), len(all))
+	}
+	for j := 1; j < len(ns); j++ {
+		if ns[j].d < ns[j-1].d {
+			t.Fatal("nearest: not ordered by distance")
+		}
+	}
+}
+
+func benchqueries() []geomys.Point {
+	rng := rand.New(rand.NewSource(4))
+	qs := make([]geomys.Point, 100)
+	for i := range qs {
+		qs[i] = geomys.Geo(math.Asin(2*rng.Float64()-1)*180/math.Pi, 360*rng.Float64()-180)
+	}
+	return qs
+}
+
+func BenchmarkPopIndex(b *testing.B) {
+	locs := synthpoplocs(200000, 5)
+	idx := newpopindex(locs)
+	qs := benchqueries()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		idx.within(qs[i%len(qs)], 50000, func(k int, d float64) { n++ })
+	}
+}
+
+func BenchmarkPopLinear(b *testing.B) {
+	locs := synthpoplocs(200000, 5)
+	qs := benchqueries()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearwithin(locs, qs[i%len(qs)], 50000)
+	}
+}
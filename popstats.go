@@ -0,0 +1,70 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"github.com/reconditematter/geomys"
+	"math"
+	"sort"
+)
+
+// popspread -- the population-weighted center and spread of a set of blocks.
+type popspread struct {
+	Center      *geolatlon `json:"center"`
+	StdDistance float64    `json:"standard_distance"`
+	MedDistance float64    `json:"median_distance"`
+}
+
+// mkpopspread -- computes the center and spread of the blocks `ns` weighted by
+// their population. The distances of `ns` are the distances from the query point.
+func mkpopspread(locs []poploc, ns []popnear) popspread {
+	var spread popspread
+	total := 0
+	var sx, sy, sz float64
+	for _, n := range ns {
+		loc := &locs[n.k]
+		total += loc.pop
+		w := float64(loc.pop)
+		sx += w * float64(loc.x)
+		sy += w * float64(loc.y)
+		sz += w * float64(loc.z)
+	}
+	if total == 0 {
+		return spread
+	}
+	// the mean center in geocentric coordinates projected onto the spheroid
+	wt := float64(total)
+	clat, clon := ecefgeo([3]float64{sx / wt, sy / wt, sz / wt})
+	spread.Center = &geolatlon{math.Round(clat*1e8) / 1e8, math.Round(clon*1e8) / 1e8}
+	//
+	spheroid := geomys.WGS1984()
+	center := geomys.Geo(clat, clon)
+	var sd2 float64
+	for _, n := range ns {
+		loc := &locs[n.k]
+		if loc.pop == 0 {
+			continue
+		}
+		d := geomys.Andoyer(spheroid, center, geomys.Geo(loc.lat, loc.lon))
+		sd2 += float64(loc.pop) * d * d
+	}
+	spread.StdDistance = math.Round(math.Sqrt(sd2/wt)*1e3) / 1e3
+	// the weighted median of the distances from the query point
+	byd := make([]popnear, len(ns))
+	copy(byd, ns)
+	sort.Slice(byd, func(i, j int) bool {
+		return byd[i].d < byd[j].d
+	})
+	cum := 0
+	for _, n := range byd {
+		cum += locs[n.k].pop
+		if 2*cum >= total {
+			spread.MedDistance = math.Round(n.d*1e3) / 1e3
+			break
+		}
+	}
+	//
+	return spread
+}
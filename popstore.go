@@ -0,0 +1,215 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/dgraph-io/badger"
+	"io"
+	"os"
+	"strings"
+)
+
+// PopStore -- provides the census records of blocks by block ID.
+//
+// A record is a comma-separated list of 49 integers (US Census 2010, table P12):
+// the total population, the male population followed by 23 male age groups,
+// and the female population followed by 23 female age groups.
+type PopStore interface {
+	// Get -- returns the records of the blocks `ids` in the same order.
+	Get(ids []string) ([]string, error)
+	// Close -- releases the resources held by the store.
+	Close() error
+}
+
+// popscanner -- a PopStore that passes the records to a function one by one
+// instead of returning them, so that they need not be held in memory at once.
+type popscanner interface {
+	// scan -- calls `f` for the record of every block of `ids` in order, stopping at the first error.
+	scan(ids []string, f func(k int, rec string) error) error
+}
+
+// popscan -- calls `f` for the record of every block of `ids` read from `store` in order.
+// The records are read with `Get` if `store` is not a popscanner.
+func popscan(store PopStore, ids []string, f func(k int, rec string) error) error {
+	if s, ok := store.(popscanner); ok {
+		return s.scan(ids, f)
+	}
+	recs, err := store.Get(ids)
+	if err != nil {
+		return err
+	}
+	for k, rec := range recs {
+		if err := f(k, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// popget -- returns the records of the blocks `ids` collected from `s.scan`.
+// The stores implement Get with it, so that a record is looked up in one place.
+func popget(s popscanner, ids []string) ([]string, error) {
+	vals := make([]string, len(ids))
+	err := s.scan(ids, func(k int, rec string) error {
+		vals[k] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// BadgerPopStore -- a PopStore backed by a Badger database.
+type BadgerPopStore struct {
+	db *badger.DB
+}
+
+// OpenBadgerPopStore -- opens the Badger database in the directory `dir` read-only.
+func OpenBadgerPopStore(dir string) (*BadgerPopStore, error) {
+	db, err := badger.Open(badger.DefaultOptions(dir).WithReadOnly(true).WithLoggingLevel(2))
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerPopStore{db}, nil
+}
+
+// Get -- returns the records of the blocks `ids` read in one transaction.
+func (s *BadgerPopStore) Get(ids []string) ([]string, error) {
+	return popget(s, ids)
+}
+
+// scan -- calls `f` for the records of the blocks `ids` read in one transaction.
+func (s *BadgerPopStore) scan(ids []string, f func(k int, rec string) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		for k, id := range ids {
+			item, err := txn.Get([]byte(id))
+			if err != nil {
+				return err
+			}
+			err = item.Value(func(val []byte) error {
+				return f(k, string(val))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close -- closes the Badger database.
+func (s *BadgerPopStore) Close() error {
+	return s.db.Close()
+}
+
+// MemPopStore -- a PopStore backed by a map from block IDs to records.
+type MemPopStore map[string]string
+
+// Get -- returns the records of the blocks `ids`.
+func (s MemPopStore) Get(ids []string) ([]string, error) {
+	return popget(s, ids)
+}
+
+// scan -- calls `f` for the records of the blocks `ids`.
+func (s MemPopStore) scan(ids []string, f func(k int, rec string) error) error {
+	for k, id := range ids {
+		val, ok := s[id]
+		if !ok {
+			return fmt.Errorf("block %s not found", id)
+		}
+		if err := f(k, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close -- does nothing.
+func (s MemPopStore) Close() error {
+	return nil
+}
+
+// CSVPopStore -- a PopStore backed by a flat file with one block per line:
+// the block ID followed by the fields of its record, separated by commas.
+// Only the line offsets are kept in memory, the records are read on demand.
+type CSVPopStore struct {
+	file *os.File
+	offs map[string][2]int64
+}
+
+// OpenCSVPopStore -- opens the flat file `name` and indexes its lines.
+func OpenCSVPopStore(name string) (*CSVPopStore, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	//
+	offs := make(map[string][2]int64)
+	rdr := bufio.NewReader(file)
+	var off int64
+	for {
+		line, err := rdr.ReadString('\n')
+		if err != nil && err != io.EOF {
+			file.Close()
+			return nil, err
+		}
+		n := int64(len(line))
+		rec := strings.TrimRight(line, "\r\n")
+		if rec != "" {
+			comma := strings.IndexByte(rec, ',')
+			if comma < 0 {
+				file.Close()
+				return nil, fmt.Errorf("%s: malformed line at offset %d", name, off)
+			}
+			id := rec[:comma]
+			if _, dup := offs[id]; dup {
+				file.Close()
+				return nil, fmt.Errorf("%s: repeated block %s", name, id)
+			}
+			offs[id] = [2]int64{off + int64(comma) + 1, int64(len(rec) - comma - 1)}
+		}
+		off += n
+		if err == io.EOF {
+			break
+		}
+	}
+	//
+	return &CSVPopStore{file, offs}, nil
+}
+
+// Get -- returns the records of the blocks `ids` read from the file.
+func (s *CSVPopStore) Get(ids []string) ([]string, error) {
+	return popget(s, ids)
+}
+
+// scan -- calls `f` for the records of the blocks `ids` read from the file.
+func (s *CSVPopStore) scan(ids []string, f func(k int, rec string) error) error {
+	buf := make([]byte, 0, 1024)
+	for k, id := range ids {
+		off, ok := s.offs[id]
+		if !ok {
+			return fmt.Errorf("block %s not found", id)
+		}
+		if int64(cap(buf)) < off[1] {
+			buf = make([]byte, off[1])
+		}
+		buf = buf[:off[1]]
+		if n, err := s.file.ReadAt(buf, off[0]); n < len(buf) {
+			return err
+		}
+		if err := f(k, string(buf)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close -- closes the file.
+func (s *CSVPopStore) Close() error {
+	return s.file.Close()
+}
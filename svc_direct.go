@@ -0,0 +1,247 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/cds"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Direct -- configures the service for the router `R`.
+func Direct(R *mux.Router) {
+	R.Handle("/api/direct", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(usageDirect))).Methods("GET")
+	R.Handle("/api/direct/lat/{lat}/lon/{lon}/azi/{azi}/distance/{distance}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(direct))).Methods("GET")
+	R.Handle("/api/direct/batch", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(directbatch))).Methods("POST")
+}
+
+func usageDirect(w http.ResponseWriter, r *http.Request) {
+	doc := `
+/api/direct/lat/{lat}/lon/{lon}/azi/{azi}/distance/{distance}[?method={method}] -- solves the direct problem: returns the location
+at the given distance from the given location in the given direction.
+
+Input:
+{lat} -- the geographic latitude of the start, must be in [-90,90]
+{lon} -- the geographic longitude of the start, must be in [-180,180]
+{azi} -- the azimuth at the start in degrees clockwise from north, must be in [-360,360]
+{distance} -- the distance in meters, must be in [0,20000000]
+{method} -- greatellipse (default), geodesic, haversine or andoyer, as in /api/greatell
+
+Output:
+{
+ "duration_ms":___,
+ "method":___,
+ "lat1":___,
+ "lon1":___,
+ "azi1":___,
+ "distance":___,
+ "lat2":___,
+ "lon2":___,
+ "azi2":___
+}
+
+{azi1} -- the azimuth {azi} reduced to (-180,180]
+{lat2},{lon2} -- the geographic coordinates of the destination
+{azi2} -- the azimuth at the destination (in the direction of travel)
+
+/api/direct/batch[?method={method}] -- (POST) solves the direct problem for many starts.
+
+Input:
+{
+ "problems":[{"id":___,"lat":___,"lon":___,"azi":___,"distance":___},...]
+}
+
+{problems} -- 1,...,1000 problems with distinct ids; the coordinates, azimuths and distances as above
+
+Output:
+{
+ "duration_ms":___,
+ "method":___,
+ "count":___,
+ "solutions":[{"id":___,"lat1":___,"lon1":___,"azi1":___,"distance":___,"lat2":___,"lon2":___,"azi2":___},...]
+}
+`
+	//
+	HS200t(w, []byte(doc))
+}
+
+// dirsolution -- a solution of the direct problem.
+type dirsolution struct {
+	Lat1     float64 `json:"lat1"`
+	Lon1     float64 `json:"lon1"`
+	Azi1     float64 `json:"azi1"`
+	Distance float64 `json:"distance"`
+	Lat2     float64 `json:"lat2"`
+	Lon2     float64 `json:"lon2"`
+	Azi2     float64 `json:"azi2"`
+}
+
+// solvedirect -- solves the direct problem by the method `nav`.
+// The azimuth is reduced to (-180,180] first.
+func solvedirect(nav geonav, lat, lon, azi, distance float64) dirsolution {
+	azi = math.Remainder(azi, 360)
+	if azi == -180 {
+		azi = 180
+	}
+	p, azi2 := nav.direct(geomys.Geo(lat, lon), azi, distance)
+	lat2, lon2 := p.Geo()
+	return dirsolution{lat, lon, azi, distance, math.Round(lat2*1e8) / 1e8, math.Round(lon2*1e8) / 1e8, math.Round(azi2*1e8) / 1e8}
+}
+
+func direct(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	vars := mux.Vars(r)
+	//
+	lat, err := strconv.ParseFloat(vars["lat"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat && lat <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon, err := strconv.ParseFloat(vars["lon"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon && lon <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	azi, err := strconv.ParseFloat(vars["azi"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-360 <= azi && azi <= 360) {
+		HS400(w)
+		return
+	}
+	//
+	distance, err := strconv.ParseFloat(vars["distance"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(0 <= distance && distance <= 20000000) {
+		HS400(w)
+		return
+	}
+	//
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	resultx := struct {
+		Duration int64  `json:"duration_ms"`
+		Method   string `json:"method"`
+		dirsolution
+	}{0, nav.name, solvedirect(nav, lat, lon, azi, distance)}
+	resultx.Duration = time.Since(start).Milliseconds()
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+func directbatch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const NMAX = 1000
+	//
+	type problem struct {
+		Id       string  `json:"id"`
+		Lat      float64 `json:"lat"`
+		Lon      float64 `json:"lon"`
+		Azi      float64 `json:"azi"`
+		Distance float64 `json:"distance"`
+	}
+	var t struct {
+		Problems []problem `json:"problems"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&t)
+	if err != nil {
+		// JSON error
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	n := len(t.Problems)
+	if n == 0 || n > NMAX {
+		// array length error
+		HS400t(w, "array length error")
+		return
+	}
+	//
+	setofid := cds.NewSetOfStr()
+	for _, p := range t.Problems {
+		if !(-90 <= p.Lat && p.Lat <= 90 && -180 <= p.Lon && p.Lon <= 180) {
+			HS400t(w, "coordinate error")
+			return
+		}
+		if !(-360 <= p.Azi && p.Azi <= 360) {
+			HS400t(w, "azimuth error")
+			return
+		}
+		if !(0 <= p.Distance && p.Distance <= 20000000) {
+			HS400t(w, "distance error")
+			return
+		}
+		setofid.Extend(p.Id)
+	}
+	if setofid.Card() != n {
+		// repeated ids error
+		HS400t(w, "repeated ids error")
+		return
+	}
+	//
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	type solution struct {
+		Id string `json:"id"`
+		dirsolution
+	}
+	result := make([]solution, n)
+	for k, p := range t.Problems {
+		result[k] = solution{p.Id, solvedirect(nav, p.Lat, p.Lon, p.Azi, p.Distance)}
+	}
+	//
+	resultx := struct {
+		Duration  int64      `json:"duration_ms"`
+		Method    string     `json:"method"`
+		Count     int        `json:"count"`
+		Solutions []solution `json:"solutions"`
+	}{time.Since(start).Milliseconds(), nav.name, n, result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSolveDirectAzimuth(t *testing.T) {
+	for name, nav := range geonavs {
+		want := solvedirect(nav, 40, -105, 135, 1000000)
+		for _, azi := range []float64{-225, 495} {
+			got := solvedirect(nav, 40, -105, azi, 1000000)
+			if got != want {
+				t.Errorf("%s: azimuth %v: %+v, expected %+v", name, azi, got, want)
+			}
+		}
+		if sol := solvedirect(nav, 40, -105, -180, 1000); sol.Azi1 != 180 {
+			t.Errorf("%s: azimuth -180 is reported as %v", name, sol.Azi1)
+		}
+		if sol := solvedirect(nav, 40, -105, 360, 1000); sol.Azi1 != 0 {
+			t.Errorf("%s: azimuth 360 is reported as %v", name, sol.Azi1)
+		}
+	}
+}
+
+func TestDirectBatch(t *testing.T) {
+	R := mux.NewRouter()
+	Direct(R)
+	tests := []struct {
+		body  string
+		code  int
+		count int
+	}{
+		{`{"problems":[{"id":"a","lat":0,"lon":0,"azi":90,"distance":1000},{"id":"b","lat":10,"lon":10,"azi":0,"distance":0}]}`, http.StatusOK, 2},
+		{`{"problems":[{"id":"a","lat":0,"lon":0,"azi":90,"distance":1000},{"id":"a","lat":10,"lon":10,"azi":0,"distance":0}]}`, http.StatusBadRequest, 0},
+		{`{"problems":[]}`, http.StatusBadRequest, 0},
+		// the body is limited to the size of 1000 problems
+		{`{"problems":[{"id":"a","lat":0,"lon":0,"azi":90,"distance":1000}` + strings.Repeat(" ", 1<<20) + `]}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("POST", "/api/direct/batch", strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%.80s: status %d, expected %d", tt.body, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var result struct {
+			Count     int `json:"count"`
+			Solutions []struct {
+				Id string `json:"id"`
+			} `json:"solutions"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Count != tt.count || len(result.Solutions) != tt.count || result.Solutions[0].Id != "a" {
+			t.Errorf("%s: %+v", tt.body, result)
+		}
+	}
+}
@@ -25,24 +25,31 @@ func GeoCircle(R *mux.Router) {
 
 func usageGeoCircle(w http.ResponseWriter, r *http.Request) {
 	doc := `
-/api/geocircle/{level}/lat/{lat}/lon/{lon}/radius/{radius} -- generates a circle around a given geographic location.
+/api/geocircle/{level}/lat/{lat}/lon/{lon}/radius/{radius}[?method={method}][&format={format}] -- generates a circle around a given geographic location.
  
 Input:
 {level} = 1,...,5 -- the level of details (1=360 points,...,5=5760 points)
 {lat} -- the geographic latitude of the center, must be in [-90,90]
 {lon} -- the geographic longitude of the center, must be in [-180,180]
 {radius} -- the circle radius in meters, must be in [1000,1000000]
+{method} -- greatellipse (default), geodesic, haversine or andoyer, as in /api/greatell
+{format} -- json (default) or geojson; also Accept: application/geo+json selects geojson
  
 Output:
 {
  "duration_ms":___,
  "type":"GeoCircle",
+ "method":___,
  "center":{"lat":___,"lon":___},
  "radius":___,
  "length":___,
  "count":___,
  "path":[{"lat":___,"lon":___},...]
 }
+
+GeoJSON output:
+A Feature with the Polygon of the circle (counterclockwise; a MultiPolygon if the circle crosses the antimeridian)
+and the properties "type", "method", "center", "radius", "length" and "count" as above.
 `
 	//
 	HS200t(w, []byte(doc))
@@ -92,16 +99,26 @@ func geocircle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	//
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	geojson, err := parsegeojson(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
 	type geo2 struct {
 		Lat float64 `json:"lat"`
 		Lon float64 `json:"lon"`
 	}
 	type geopath2 []geo2
 	//
-	circle := gengeocircle(geomys.Geo(lat, lon), float64(radius), int(level))
-	genav := geomys.NewGreatEllipse(geomys.WGS1984())
+	circle := gengeocircle(nav, geomys.Geo(lat, lon), float64(radius), int(level))
 	pathlength := math.Round(mym.AccuSum(len(circle)-1, func(i int) float64 {
-		s, _, _ := genav.Inverse(circle[i], circle[i+1])
+		s, _, _ := nav.inverse(circle[i], circle[i+1])
 		return s
 	})*1e2) / 1e2
 	result := make(geopath2, len(circle))
@@ -110,15 +127,46 @@ func geocircle(w http.ResponseWriter, r *http.Request) {
 		result[k] = geo2{Lat: math.Round(lat*1e8) / 1e8, Lon: math.Round(lon*1e8) / 1e8}
 	}
 	//
+	if geojson {
+		ring := make([]geolatlon, len(result))
+		for k, p := range result {
+			// the circle is generated clockwise
+			ring[len(ring)-1-k] = geolatlon{p.Lat, p.Lon}
+		}
+		props := struct {
+			Type   string  `json:"type"`
+			Method string  `json:"method"`
+			Center geo2    `json:"center"`
+			Radius int64   `json:"radius"`
+			Length float64 `json:"length"`
+			Count  int     `json:"count"`
+		}{"GeoCircle", nav.name, geo2{math.Round(lat*1e8) / 1e8, math.Round(lon*1e8) / 1e8}, radius, pathlength, len(result)}
+		//
+		geometry, err := gjring(ring)
+		if err != nil {
+			HS500(w)
+			return
+		}
+		jresult, err := json.Marshal(gjfeature{"Feature", geometry, props})
+		if err != nil {
+			HS500(w)
+			return
+		}
+		//
+		HS200geojson(w, jresult)
+		return
+	}
+	//
 	resultx := struct {
 		Duration int64    `json:"duration_ms"`
 		Type     string   `json:"type"`
+		Method   string   `json:"method"`
 		Center   geo2     `json:"center"`
 		Radius   int64    `json:"radius"`
 		Length   float64  `json:"length"`
 		Count    int      `json:"count"`
 		Path     geopath2 `json:"path"`
-	}{time.Since(start).Milliseconds(), "GeoCircle", geo2{math.Round(lat*1e8) / 1e8, math.Round(lon*1e8) / 1e8}, radius, pathlength, len(result), result}
+	}{time.Since(start).Milliseconds(), "GeoCircle", nav.name, geo2{math.Round(lat*1e8) / 1e8, math.Round(lon*1e8) / 1e8}, radius, pathlength, len(result), result}
 	//
 	jresult, err := json.Marshal(resultx)
 	if err != nil {
@@ -129,7 +177,7 @@ func geocircle(w http.ResponseWriter, r *http.Request) {
 	HS200j(w, jresult)
 }
 
-func gengeocircle(c geomys.Point, s float64, level int) (ps []geomys.Point) {
+func gengeocircle(nav geonav, c geomys.Point, s float64, level int) (ps []geomys.Point) {
 	if level < 1 {
 		level = 1
 	}
@@ -152,13 +200,12 @@ func gengeocircle(c geomys.Point, s float64, level int) (ps []geomys.Point) {
 	//
 	step := 360.0 / float64(n)
 	ps = make([]geomys.Point, n+1)
-	genav := geomys.NewGreatEllipse(geomys.WGS1984())
 	for k := 0; k < n; k++ {
 		alpha := float64(k) * step
 		if alpha > 180 {
 			alpha -= 360
 		}
-		p, _ := genav.Direct(c, alpha, s)
+		p, _ := nav.direct(c, alpha, s)
 		ps[k] = p
 	}
 	ps[n] = ps[0]
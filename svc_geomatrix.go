@@ -36,6 +36,8 @@ func usageGeoMatrix(w http.ResponseWriter, r *http.Request) {
 /api/geomatrix/distances[/sort] -- (POST) computes a matrix of geographic distances between given locations.
 
 [/sort] -- orders the output by geographic distances.
+[?method={method}] -- greatellipse (default), geodesic, haversine or andoyer, as in /api/greatell
+[?format={format}] -- json (default) or geojson; also Accept: application/geo+json selects geojson
 
 Input:
 {
@@ -46,6 +48,7 @@ Input:
 Output:
 {
  "duration_ms:___,
+ "method":___,
  "count":___,
  "distances":
   [
@@ -57,6 +60,11 @@ Output:
    },...
   ]
 }
+
+GeoJSON output:
+A FeatureCollection with a Feature for every pair of the locations: the LineString of the path
+between the locations by {method}, with a point at least every 200 km (a MultiLineString if the path
+crosses the antimeridian), and the properties "from", "to", "km" and "mi" as above.
 `
 	//
 	HS200t(w, []byte(doc))
@@ -236,7 +244,18 @@ func matloc(w http.ResponseWriter, r *http.Request, loc []location, dosort bool)
 		crd[i][1] = loci.Lon
 	}
 	//
-	D, err := computegeomat(crd)
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	geojson, err := parsegeojson(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	D, err := computegeomat(nav, crd)
 	if err != nil {
 		HS400t(w, err.Error())
 		return
@@ -254,14 +273,49 @@ func matloc(w http.ResponseWriter, r *http.Request, loc []location, dosort bool)
 	//
 	resultx := struct {
 		Duration int64  `json:"duration_ms"`
+		Method   string `json:"method"`
 		Count    int    `json:"count"`
 		Dist     []jrep `json:"distances"`
-	}{0, len(result), result}
+	}{0, nav.name, len(result), result}
 	//
 	if dosort {
 		sort.Sort(distslice(resultx.Dist))
 	}
 	//
+	if geojson {
+		ids := make(map[string]int, n)
+		for i, loci := range loc {
+			ids[loci.Id] = i
+		}
+		// the path between the locations has a point every H meters
+		const H = 200000
+		features := make([]gjfeature, len(resultx.Dist))
+		for k, d := range resultx.Dist {
+			p1, p2 := loc[ids[d.From]], loc[ids[d.To]]
+			seg := newgeseg(nav, geomys.Geo(p1.Lat, p1.Lon), geomys.Geo(p2.Lat, p2.Lon))
+			count := int(math.Ceil(seg.s12/H)) + 1
+			if count < 2 {
+				count = 2
+			}
+			points, _ := seg.sample(count)
+			line := make([]geolatlon, len(points))
+			for j, p := range points {
+				lat, lon := p.Geo()
+				line[j] = geolatlon{math.Round(lat*1e8) / 1e8, math.Round(lon*1e8) / 1e8}
+			}
+			features[k] = gjfeature{"Feature", gjline(line), d}
+		}
+		//
+		resultj, err := json.Marshal(gjcollection{"FeatureCollection", features})
+		if err != nil {
+			HS500(w)
+			return
+		}
+		//
+		HS200geojson(w, resultj)
+		return
+	}
+	//
 	resultx.Duration = time.Since(start).Milliseconds()
 	//
 	resultj, err := json.Marshal(resultx)
@@ -273,10 +327,9 @@ func matloc(w http.ResponseWriter, r *http.Request, loc []location, dosort bool)
 	HS200j(w, resultj)
 }
 
-func computegeomat(points [][2]float64) (map[[2]int]float64, error) {
+func computegeomat(nav geonav, points [][2]float64) (map[[2]int]float64, error) {
 	n := len(points)
 	mat := make(map[[2]int]float64)
-	genav := geomys.NewGreatEllipse(geomys.WGS1984())
 	//
 	for i, pi := range points {
 		lati, loni := pi[0], pi[1]
@@ -293,7 +346,7 @@ func computegeomat(points [][2]float64) (map[[2]int]float64, error) {
 			}
 			//
 			p2 := geomys.Geo(latj, lonj)
-			d, _, _ := genav.Inverse(p1, p2)
+			d, _, _ := nav.inverse(p1, p2)
 			mat[[2]int{i, j}] = d
 		}
 	}
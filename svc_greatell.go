@@ -19,12 +19,15 @@ import (
 // GreatEll -- configures the service for the router `R`.
 func GreatEll(R *mux.Router) {
 	R.Handle("/api/greatell", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(usageGreatEll))).Methods("GET")
-	R.Handle("/api/greatell/{count}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(greatell))).Methods("GET")
+	R.Handle("/api/greatell/{count}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(greatellcount))).Methods("GET")
+	R.Handle("/api/greatell/step/{step}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(greatellstep))).Methods("GET")
+	R.Handle("/api/greatell/deviation/{deviation}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(greatelldev))).Methods("GET")
+	R.Handle("/api/greatell/route", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(greatellroute))).Methods("POST")
 }
 
 func usageGreatEll(w http.ResponseWriter, r *http.Request) {
 	doc := `
-/api/greatell/{count}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2} -- generates a path along the great ellipse between two given geographic locations.
+/api/greatell/{count}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}[?method={method}][&format={format}] -- generates a path along the great ellipse (or the curve of {method}) between two given geographic locations.
 
 Input:
 {count} = 3,...,1001 -- the number of points in the generated path
@@ -32,38 +35,169 @@ Input:
 {lon1} -- the geographic longitude of the source, must be in [-180,180]
 {lat2} -- the geographic latitude of the target, must be in [-90,90]
 {lon2} -- the geographic longitude of the target, must be in [-180,180]
+{method} -- the path between the locations (default greatellipse):
+            greatellipse -- the great ellipse of WGS1984
+            geodesic -- the geodesic of WGS1984 (Karney's algorithms, accurate to nanometers)
+            haversine -- the great circle of the sphere of the mean radius of WGS1984
+            andoyer -- the geodesic, with the distance of the Andoyer-Lambert approximation
+{format} -- json (default) or geojson; also Accept: application/geo+json selects geojson
 
 Output:
 {
  "duration_ms":___,
- "type":"GreatEllipse",
+ "type":___,
+ "method":___,
  "source":{"lat":___,"lon":___},
  "target":{"lat":___,"lon":___},
  "count":___,
  "distance":___,
  "step":___,
+ "vertex":
+  {
+   "max":{"lat":___,"lon":___,"s":___},
+   "min":{"lat":___,"lon":___,"s":___},
+   "antimeridian":___,
+   "pole_distance":___,
+   "near_pole":___
+  },
  "path":[{"lat":___,"lon":___,"azi":___},...]
 }
 
+{type} -- the curve of the path: GreatEllipse (greatellipse), Geodesic (geodesic, andoyer) or GreatCircle (haversine)
 {distance} -- the distance between the source and the target points in meters
 {step} -- the distance between two consecutive points on the path in meters
+{vertex} -- the extreme latitudes of the path:
+            {max},{min} -- the northernmost and the southernmost points of the path
+                           and their distances {s} from the source along the path in meters;
+                           the vertex of the curve if the path reaches it, otherwise an endpoint
+            {antimeridian} -- true if the path crosses the antimeridian (180 degrees of longitude)
+            {pole_distance} -- the distance from the path to the nearest pole along the meridian in meters
+            {near_pole} -- true if the path passes within 100 km of a pole
+
+GeoJSON output:
+A Feature with the LineString of the path (a MultiLineString if the path crosses the antimeridian)
+and the properties "type", "method", "count", "distance", "step", "deviation" and "vertex" as above.
+
+/api/greatell/step/{step}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}[?method={method}][&format={format}] -- as above, with a point every {step} meters.
+/api/greatell/deviation/{deviation}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}[?method={method}][&format={format}] -- as above, with the points evenly spaced
+and so dense that the path drawn as straight lines in the lat/lon plane deviates less than {deviation} meters from the curve.
+
+Input:
+{step} -- the distance between two consecutive points in meters, must be in [1,20000000];
+          the last piece of the path is shorter unless {step} divides {distance};
+          the output {step} is {distance} if {step} is longer, as the path has only its two endpoints
+{deviation} -- the largest deviation in meters, must be in [0.01,100000];
+               it is measured at the midpoints of the pieces of the path
+The path can have at most 1001 points.
+
+Output:
+As above; in the deviation mode also
+ "deviation":___
+
+{deviation} -- the largest deviation of the path in meters
+
+/api/greatell/route[?method={method}][&format={format}] -- (POST) generates a path along the great ellipse (or the curve of {method}) through the given waypoints.
+
+Input:
+{
+ "count":___,
+ "waypoints":[{"lat":___,"lon":___},...]
+}
+
+{count} = 3,...,1001 -- the number of points in the generated path of every leg;
+                        instead of "count", either "step" or "deviation" can be given as above
+{waypoints} -- 2,...,100 geographic locations in the order of the route
+{method} -- as above
+
+Output:
+{
+ "duration_ms":___,
+ "type":___,
+ "method":___,
+ "leg_count":___,
+ "length":___,
+ "legs":
+  [
+   {
+    "source":{"lat":___,"lon":___},
+    "target":{"lat":___,"lon":___},
+    "distance":___,
+    "azi1":___,
+    "azi2":___,
+    "step":___,
+    "vertex":{...},
+    "path":[{"lat":___,"lon":___,"azi":___,"s":___},...]
+   },...
+  ]
+}
+
+{type} -- the curve of the legs followed by "Route", e.g. GreatEllipseRoute
+{leg_count} -- the number of legs (the input {count} is the number of points of every leg)
+{length} -- the length of the route in meters
+{distance} -- the length of the leg in meters
+{azi1},{azi2} -- the azimuths of the leg at its source and at its target
+{vertex} -- the extreme latitudes of the leg as above, {s} from the source of the leg
+{s} -- the distance of the point from the start of the route along the route in meters
+
+GeoJSON output:
+A FeatureCollection with a Feature for every leg: the LineString of the path of the leg
+and the properties "source", "target", "distance", "azi1", "azi2", "step" and "vertex" as above.
 `
 	//
 	HS200t(w, []byte(doc))
 }
 
-func greatell(w http.ResponseWriter, r *http.Request) {
+func greatellcount(w http.ResponseWriter, r *http.Request) {
+	greatell(w, r, "count")
+}
+
+func greatellstep(w http.ResponseWriter, r *http.Request) {
+	greatell(w, r, "step")
+}
+
+func greatelldev(w http.ResponseWriter, r *http.Request) {
+	greatell(w, r, "deviation")
+}
+
+func greatell(w http.ResponseWriter, r *http.Request, mode string) {
 	start := time.Now()
 	vars := mux.Vars(r)
 	//
-	count, err := strconv.ParseInt(vars["count"], 10, 64)
-	if err != nil {
-		HS400(w)
-		return
-	}
-	if !(3 <= count && count <= 1001) {
-		HS400(w)
-		return
+	var gs gesampling
+	switch mode {
+	case "count":
+		count, err := strconv.ParseInt(vars["count"], 10, 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		if !(3 <= count && count <= 1001) {
+			HS400(w)
+			return
+		}
+		gs.count = int(count)
+	case "step":
+		step, err := strconv.ParseFloat(vars["step"], 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		if !(1 <= step && step <= 20000000) {
+			HS400(w)
+			return
+		}
+		gs.step = step
+	case "deviation":
+		deviation, err := strconv.ParseFloat(vars["deviation"], 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		if !(0.01 <= deviation && deviation <= 100000) {
+			HS400(w)
+			return
+		}
+		gs.deviation = deviation
 	}
 	//
 	lat1, err := strconv.ParseFloat(vars["lat1"], 64)
@@ -106,6 +240,17 @@ func greatell(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	//
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	geojson, err := parsegeojson(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
 	type geo2 struct {
 		Lat float64 `json:"lat"`
 		Lon float64 `json:"lon"`
@@ -117,34 +262,222 @@ func greatell(w http.ResponseWriter, r *http.Request) {
 	}
 	type geopath []geo3
 	//
-	result := make(geopath, 0)
-	source := geomys.Geo(lat1, lon1)
-	target := geomys.Geo(lat2, lon2)
-	sph := geomys.WGS1984()
-	ell := geomys.NewGreatEllipse(sph)
-	s12, azi1, azi2 := ell.Inverse(source, target)
+	seg := newgeseg(nav, geomys.Geo(lat1, lon1), geomys.Geo(lat2, lon2))
+	sam, ok := gs.apply(&seg, 1001)
+	if !ok {
+		HS400t(w, "too many points")
+		return
+	}
+	result := make(geopath, len(sam.points))
+	for k, loc := range sam.points {
+		t1, t2 := loc.Geo()
+		result[k] = geo3{math.Round(t1*1e8) / 1e8, math.Round(t2*1e8) / 1e8, math.Round(sam.azis[k]*1e8) / 1e8}
+	}
+	s12 := seg.s12
+	var deviation *float64
+	if mode == "deviation" {
+		d := math.Round(sam.deviation*1e3) / 1e3
+		deviation = &d
+	}
 	//
-	result = append(result, geo3{math.Round(lat1*1e8) / 1e8, math.Round(lon1*1e8) / 1e8, math.Round(azi1*1e8) / 1e8})
+	if geojson {
+		line := make([]geolatlon, len(result))
+		for k, p := range result {
+			line[k] = geolatlon{p.Lat, p.Lon}
+		}
+		props := struct {
+			Type      string   `json:"type"`
+			Method    string   `json:"method"`
+			Count     int      `json:"count"`
+			Distance  float64  `json:"distance"`
+			Step      float64  `json:"step"`
+			Deviation *float64 `json:"deviation,omitempty"`
+			Vertex    gevertex `json:"vertex"`
+		}{nav.curve, nav.name, len(result), math.Round(s12*1e3) / 1e3, math.Round(sam.step*1e3) / 1e3, deviation, seg.vertex()}
+		//
+		jresult, err := json.Marshal(gjfeature{"Feature", gjline(line), props})
+		if err != nil {
+			HS500(w)
+			return
+		}
+		//
+		HS200geojson(w, jresult)
+		return
+	}
 	//
-	step := s12 / float64(count-1)
-	for k := 1; k < int(count)-1; k++ {
-		loc, azi := ell.Direct(source, azi1, float64(k)*step)
-		t1, t2 := loc.Geo()
-		result = append(result, geo3{math.Round(t1*1e8) / 1e8, math.Round(t2*1e8) / 1e8, math.Round(azi*1e8) / 1e8})
+	resultx := struct {
+		Duration  int64    `json:"duration_ms"`
+		Type      string   `json:"type"`
+		Method    string   `json:"method"`
+		Source    geo2     `json:"source"`
+		Target    geo2     `json:"target"`
+		Count     int      `json:"count"`
+		Distance  float64  `json:"distance"`
+		Step      float64  `json:"step"`
+		Deviation *float64 `json:"deviation,omitempty"`
+		Vertex    gevertex `json:"vertex"`
+		Path      geopath  `json:"path"`
+	}{time.Since(start).Milliseconds(), nav.curve, nav.name, geo2{result[0].Lat, result[0].Lon}, geo2{result[len(result)-1].Lat, result[len(result)-1].Lon}, len(result), math.Round(s12*1e3) / 1e3, math.Round(sam.step*1e3) / 1e3, deviation, seg.vertex(), result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+func greatellroute(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const NMAX = 100
+	//
+	type geo2 struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	var t struct {
+		Count     int64   `json:"count"`
+		Step      float64 `json:"step"`
+		Deviation float64 `json:"deviation"`
+		Waypoints []geo2  `json:"waypoints"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&t)
+	if err != nil {
+		// JSON error
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	var gs gesampling
+	switch {
+	case t.Count != 0 && t.Step == 0 && t.Deviation == 0:
+		if !(3 <= t.Count && t.Count <= 1001) {
+			HS400t(w, "count error")
+			return
+		}
+		gs.count = int(t.Count)
+	case t.Count == 0 && t.Step != 0 && t.Deviation == 0:
+		if !(1 <= t.Step && t.Step <= 20000000) {
+			HS400t(w, "step error")
+			return
+		}
+		gs.step = t.Step
+	case t.Count == 0 && t.Step == 0 && t.Deviation != 0:
+		if !(0.01 <= t.Deviation && t.Deviation <= 100000) {
+			HS400t(w, "deviation error")
+			return
+		}
+		gs.deviation = t.Deviation
+	default:
+		HS400t(w, "one of count, step and deviation must be given")
+		return
+	}
+	n := len(t.Waypoints)
+	if n < 2 || n > NMAX {
+		// array length error
+		HS400t(w, "array length error")
+		return
+	}
+	for _, p := range t.Waypoints {
+		if !(-90 <= p.Lat && p.Lat <= 90 && -180 <= p.Lon && p.Lon <= 180) {
+			HS400t(w, "coordinate error")
+			return
+		}
 	}
 	//
-	result = append(result, geo3{math.Round(lat2*1e8) / 1e8, math.Round(lon2*1e8) / 1e8, math.Round(azi2*1e8) / 1e8})
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	geojson, err := parsegeojson(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	type geo4 struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+		Azi float64 `json:"azi"`
+		S   float64 `json:"s"`
+	}
+	type leg struct {
+		Source   geo2     `json:"source"`
+		Target   geo2     `json:"target"`
+		Distance float64  `json:"distance"`
+		Azi1     float64  `json:"azi1"`
+		Azi2     float64  `json:"azi2"`
+		Step     float64  `json:"step"`
+		Vertex   gevertex `json:"vertex"`
+		Path     []geo4   `json:"path,omitempty"`
+	}
+	//
+	legs := make([]leg, n-1)
+	length := 0.0
+	for i := range legs {
+		p1, p2 := t.Waypoints[i], t.Waypoints[i+1]
+		seg := newgeseg(nav, geomys.Geo(p1.Lat, p1.Lon), geomys.Geo(p2.Lat, p2.Lon))
+		sam, ok := gs.apply(&seg, 1001)
+		if !ok {
+			HS400t(w, "too many points")
+			return
+		}
+		path := make([]geo4, len(sam.points))
+		for k, loc := range sam.points {
+			t1, t2 := loc.Geo()
+			s := length + float64(k)*sam.step
+			if k == len(sam.points)-1 {
+				s = length + seg.s12
+			}
+			path[k] = geo4{math.Round(t1*1e8) / 1e8, math.Round(t2*1e8) / 1e8, math.Round(sam.azis[k]*1e8) / 1e8, math.Round(s*1e3) / 1e3}
+		}
+		legs[i] = leg{
+			Source:   geo2{path[0].Lat, path[0].Lon},
+			Target:   geo2{path[len(path)-1].Lat, path[len(path)-1].Lon},
+			Distance: math.Round(seg.s12*1e3) / 1e3,
+			Azi1:     math.Round(seg.azi1*1e8) / 1e8,
+			Azi2:     math.Round(seg.azi2*1e8) / 1e8,
+			Step:     math.Round(sam.step*1e3) / 1e3,
+			Vertex:   seg.vertex(),
+			Path:     path,
+		}
+		length += seg.s12
+	}
+	//
+	if geojson {
+		features := make([]gjfeature, len(legs))
+		for i, l := range legs {
+			line := make([]geolatlon, len(l.Path))
+			for k, p := range l.Path {
+				line[k] = geolatlon{p.Lat, p.Lon}
+			}
+			props := l
+			props.Path = nil
+			features[i] = gjfeature{"Feature", gjline(line), props}
+		}
+		//
+		jresult, err := json.Marshal(gjcollection{"FeatureCollection", features})
+		if err != nil {
+			HS500(w)
+			return
+		}
+		//
+		HS200geojson(w, jresult)
+		return
+	}
 	//
 	resultx := struct {
 		Duration int64   `json:"duration_ms"`
 		Type     string  `json:"type"`
-		Source   geo2    `json:"source"`
-		Target   geo2    `json:"target"`
-		Count    int     `json:"count"`
-		Distance float64 `json:"distance"`
-		Step     float64 `json:"step"`
-		Path     geopath `json:"path"`
-	}{time.Since(start).Milliseconds(), "GreatEllipse", geo2{result[0].Lat, result[0].Lon}, geo2{result[len(result)-1].Lat, result[len(result)-1].Lon}, len(result), math.Round(s12*1e3) / 1e3, math.Round(step*1e3) / 1e3, result}
+		Method   string  `json:"method"`
+		LegCount int     `json:"leg_count"`
+		Length   float64 `json:"length"`
+		Legs     []leg   `json:"legs"`
+	}{time.Since(start).Milliseconds(), nav.curve + "Route", nav.name, len(legs), math.Round(length*1e3) / 1e3, legs}
 	//
 	jresult, err := json.Marshal(resultx)
 	if err != nil {
@@ -154,3 +487,203 @@ func greatell(w http.ResponseWriter, r *http.Request) {
 	//
 	HS200j(w, jresult)
 }
+
+// geseg -- a segment of the great ellipse (or of the path of another method) between two locations.
+type geseg struct {
+	source, target  geomys.Point
+	s12, azi1, azi2 float64
+	direct          func(p geomys.Point, azi, s float64) (geomys.Point, float64)
+}
+
+// newgeseg -- solves the inverse problem for the segment from `source` to `target` by the method `nav`.
+func newgeseg(nav geonav, source, target geomys.Point) geseg {
+	s12, azi1, azi2 := nav.inverse(source, target)
+	return geseg{source, target, s12, azi1, azi2, nav.direct}
+}
+
+// at -- returns the point of the segment at the distance `s` from the source and the azimuth there.
+func (g *geseg) at(s float64) (geomys.Point, float64) {
+	return g.direct(g.source, g.azi1, s)
+}
+
+// sample -- returns `count` (at least 2) points evenly spaced along the segment and the azimuths there.
+// The first and the last points are exactly the source and the target.
+func (g *geseg) sample(count int) ([]geomys.Point, []float64) {
+	points := make([]geomys.Point, count)
+	azis := make([]float64, count)
+	points[0], azis[0] = g.source, g.azi1
+	step := g.s12 / float64(count-1)
+	for k := 1; k < count-1; k++ {
+		points[k], azis[k] = g.at(float64(k) * step)
+	}
+	points[count-1], azis[count-1] = g.target, g.azi2
+	return points, azis
+}
+
+// gesampling -- how a segment is sampled: by the number of points, by the distance
+// between the points, or by the largest deviation from the segment. One of these is set.
+type gesampling struct {
+	count     int
+	step      float64
+	deviation float64
+}
+
+// gesample -- the points of a sampled segment, the azimuths there,
+// the distance between the points and the largest deviation (in the deviation mode).
+type gesample struct {
+	points          []geomys.Point
+	azis            []float64
+	step, deviation float64
+}
+
+// apply -- samples the segment `g`, or returns false if more than `cmax` points are needed.
+func (gs gesampling) apply(g *geseg, cmax int) (gesample, bool) {
+	var sam gesample
+	switch {
+	case gs.step > 0:
+		count := int(math.Ceil(g.s12/gs.step)) + 1
+		if count < 2 {
+			count = 2
+		}
+		if count > cmax {
+			return sam, false
+		}
+		sam.points = make([]geomys.Point, count)
+		sam.azis = make([]float64, count)
+		sam.points[0], sam.azis[0] = g.source, g.azi1
+		for k := 1; k < count-1; k++ {
+			sam.points[k], sam.azis[k] = g.at(float64(k) * gs.step)
+		}
+		sam.points[count-1], sam.azis[count-1] = g.target, g.azi2
+		sam.step = gs.step
+		if count == 2 {
+			// the only piece is the segment
+			sam.step = g.s12
+		}
+		return sam, true
+	case gs.deviation > 0:
+		n := 1
+		for {
+			d := g.deviation(n)
+			if d < gs.deviation {
+				sam.deviation = d
+				break
+			}
+			// the deviation decreases about as 1/n^2
+			m := int(math.Ceil(float64(n) * math.Sqrt(d/gs.deviation)))
+			if m <= n {
+				m = n + 1
+			}
+			if m > cmax-1 {
+				if n == cmax-1 {
+					return sam, false
+				}
+				m = cmax - 1
+			}
+			n = m
+		}
+		sam.points, sam.azis = g.sample(n + 1)
+		sam.step = g.s12 / float64(n)
+		return sam, true
+	}
+	sam.points, sam.azis = g.sample(gs.count)
+	sam.step = g.s12 / float64(gs.count-1)
+	return sam, true
+}
+
+// deviation -- returns the largest distance between the midpoints of the `n` equal pieces
+// of the segment and the midpoints of the straight lines between their ends in the lat/lon plane.
+func (g *geseg) deviation(n int) float64 {
+	geocen := geomys.NewGeocentric(geomys.WGS1984())
+	step := g.s12 / float64(n)
+	p1 := g.source
+	dmax := 0.0
+	for k := 1; k <= n; k++ {
+		p2 := g.target
+		if k < n {
+			p2, _ = g.at(float64(k) * step)
+		}
+		mid, _ := g.at((float64(k) - 0.5) * step)
+		lat1, lon1 := p1.Geo()
+		lat2, lon2 := p2.Geo()
+		// the straight line crosses the antimeridian if it is shorter that way
+		lon := math.Remainder(lon1+math.Remainder(lon2-lon1, 360)/2, 360)
+		a := geocen.Forward(mid)
+		b := geocen.Forward(geomys.Geo((lat1+lat2)/2, lon))
+		dmax = math.Max(dmax, math.Sqrt((a[0]-b[0])*(a[0]-b[0])+(a[1]-b[1])*(a[1]-b[1])+(a[2]-b[2])*(a[2]-b[2])))
+		p1 = p2
+	}
+	return dmax
+}
+
+// gelatext -- a point of a segment where the latitude is extreme, and its distance from the source.
+type gelatext struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+	S   float64 `json:"s"`
+}
+
+// gevertex -- the extreme latitudes of a segment.
+type gevertex struct {
+	Max          gelatext `json:"max"`
+	Min          gelatext `json:"min"`
+	Antimeridian bool     `json:"antimeridian"`
+	PoleDistance float64  `json:"pole_distance"`
+	NearPole     bool     `json:"near_pole"`
+}
+
+// vertex -- returns the extreme latitudes of the segment. The segment is sampled,
+// and the latitude is maximized (minimized) around the northernmost (southernmost) sample.
+func (g *geseg) vertex() gevertex {
+	const count = 65
+	const NEARPOLE = 100000
+	step := g.s12 / float64(count-1)
+	points, _ := g.sample(count)
+	lats := make([]float64, count)
+	imax, imin := 0, 0
+	antimeridian := false
+	_, lon := points[0].Geo()
+	for k, p := range points {
+		lat, lonk := p.Geo()
+		lats[k] = lat
+		if lat > lats[imax] {
+			imax = k
+		}
+		if lat < lats[imin] {
+			imin = k
+		}
+		if k > 0 {
+			// the longitude is followed continuously along the segment
+			lon += math.Remainder(lonk-lon, 360)
+			if !(-180 <= lon && lon <= 180) {
+				antimeridian = true
+			}
+		}
+	}
+	// extreme -- the extreme latitude around the sample `i` (sign = 1 for the maximum, -1 for the minimum)
+	extreme := func(i int, sign float64) gelatext {
+		a := math.Max(0, float64(i-1)*step)
+		b := math.Min(g.s12, float64(i+1)*step)
+		s, _ := goldenmin(func(s float64) float64 {
+			p, _ := g.at(s)
+			lat, _ := p.Geo()
+			return -sign * lat
+		}, a, b, 0.001)
+		p, _ := g.at(s)
+		if lat, _ := p.Geo(); sign*lats[i] >= sign*lat {
+			// the sample itself (an endpoint)
+			p, s = points[i], float64(i)*step
+			if i == count-1 {
+				s = g.s12
+			}
+		}
+		lat, lon := p.Geo()
+		return gelatext{math.Round(lat*1e8) / 1e8, math.Round(lon*1e8) / 1e8, math.Round(s*1e3) / 1e3}
+	}
+	v := gevertex{Max: extreme(imax, 1), Min: extreme(imin, -1), Antimeridian: antimeridian}
+	φ := math.Max(v.Max.Lat, -v.Min.Lat) * math.Pi / 180
+	d := meridarc(math.Pi/2) - meridarc(φ)
+	v.PoleDistance = math.Round(d*1e3) / 1e3
+	v.NearPole = d < NEARPOLE
+	return v
+}
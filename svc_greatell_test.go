@@ -0,0 +1,223 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// checksample -- checks that the sample starts at the source, ends at the target,
+// and that all pieces but the last one are `step` long.
+func checksample(t *testing.T, name string, nav geonav, g *geseg, sam gesample, step float64) {
+	t.Helper()
+	n := len(sam.points)
+	if sam.points[0] != g.source || sam.points[n-1] != g.target {
+		t.Errorf("%s: the sample does not start at the source and end at the target", name)
+	}
+	for k := 1; k < n; k++ {
+		s, _, _ := nav.inverse(sam.points[k-1], sam.points[k])
+		if k < n-1 && math.Abs(s-step) > 1e-6 || k == n-1 && s > step+1e-6 {
+			t.Errorf("%s: piece %d is %.6f m long, the step is %.6f m", name, k, s, step)
+		}
+	}
+}
+
+func TestGeSampling(t *testing.T) {
+	nav := geonavs["geodesic"]
+	g := newgeseg(nav, geomys.Geo(51.47, -0.46), geomys.Geo(40.64, -73.78))
+	//
+	sam, ok := gesampling{count: 11}.apply(&g, 1001)
+	if !ok || len(sam.points) != 11 || math.Abs(sam.step-g.s12/10) > 1e-9 {
+		t.Fatalf("count: %d points, step %v", len(sam.points), sam.step)
+	}
+	checksample(t, "count", nav, &g, sam, sam.step)
+	//
+	sam, ok = gesampling{step: 100000}.apply(&g, 1001)
+	if !ok || len(sam.points) != int(math.Ceil(g.s12/100000))+1 || sam.step != 100000 {
+		t.Fatalf("step: %d points, step %v", len(sam.points), sam.step)
+	}
+	checksample(t, "step", nav, &g, sam, 100000)
+	if _, ok := (gesampling{step: 1000}).apply(&g, 1001); ok {
+		t.Error("step: more than 1001 points")
+	}
+	// a step longer than the segment: the spacing of the two points is the length of the segment
+	sam, ok = gesampling{step: 2 * g.s12}.apply(&g, 1001)
+	if !ok || len(sam.points) != 2 || sam.step != g.s12 {
+		t.Fatalf("long step: %d points, step %v", len(sam.points), sam.step)
+	}
+	checksample(t, "long step", nav, &g, sam, sam.step)
+	//
+	sam, ok = gesampling{deviation: 100}.apply(&g, 1001)
+	if !ok || !(sam.deviation < 100) || sam.deviation != g.deviation(len(sam.points)-1) {
+		t.Fatalf("deviation: %d points, deviation %v", len(sam.points), sam.deviation)
+	}
+	checksample(t, "deviation", nav, &g, sam, sam.step)
+	// a coarser sample deviates more
+	if d := g.deviation(len(sam.points) / 2); !(d >= 100) {
+		t.Errorf("deviation: %d pieces deviate %v m", len(sam.points)/2, d)
+	}
+	if _, ok := (gesampling{deviation: 0.01}).apply(&g, 1001); ok {
+		t.Error("deviation: more than 1001 points")
+	}
+}
+
+func TestGreatEllModes(t *testing.T) {
+	R := mux.NewRouter()
+	GreatEll(R)
+	tests := []struct {
+		path  string
+		code  int
+		count int
+	}{
+		{"/api/greatell/11/lat1/51.47/lon1/-0.46/lat2/40.64/lon2/-73.78?method=geodesic", http.StatusOK, 11},
+		{"/api/greatell/step/100000/lat1/51.47/lon1/-0.46/lat2/40.64/lon2/-73.78?method=geodesic", http.StatusOK, 57},
+		{"/api/greatell/step/1000/lat1/51.47/lon1/-0.46/lat2/40.64/lon2/-73.78?method=geodesic", http.StatusBadRequest, 0},
+		{"/api/greatell/step/20000000/lat1/51.47/lon1/-0.46/lat2/40.64/lon2/-73.78?method=geodesic", http.StatusOK, 2},
+		{"/api/greatell/deviation/0.01/lat1/51.47/lon1/-0.46/lat2/40.64/lon2/-73.78", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, expected %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var result struct {
+			Type     string  `json:"type"`
+			Count    int     `json:"count"`
+			Distance float64 `json:"distance"`
+			Step     float64 `json:"step"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Type != "Geodesic" || result.Count != tt.count {
+			t.Errorf("%s: %+v", tt.path, result)
+		}
+		// the step of two points is the distance
+		if result.Count == 2 && result.Step != result.Distance {
+			t.Errorf("%s: %+v", tt.path, result)
+		}
+	}
+}
+
+func TestGreatEllRoute(t *testing.T) {
+	R := mux.NewRouter()
+	GreatEll(R)
+	tests := []struct {
+		body string
+		code int
+		legs int
+	}{
+		{`{"count":3,"waypoints":[{"lat":51.47,"lon":-0.46},{"lat":40.64,"lon":-73.78},{"lat":61.17,"lon":-150}]}`, http.StatusOK, 2},
+		{`{"count":3,"step":1000,"waypoints":[{"lat":51.47,"lon":-0.46},{"lat":40.64,"lon":-73.78}]}`, http.StatusBadRequest, 0},
+		{`{"count":3,"waypoints":[{"lat":51.47,"lon":-0.46}]}`, http.StatusBadRequest, 0},
+		// the body is limited to the size of 100 waypoints
+		{`{"count":3,"waypoints":[{"lat":51.47,"lon":-0.46},{"lat":40.64,"lon":-73.78}` + strings.Repeat(" ", 1<<16) + `]}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("POST", "/api/greatell/route", strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%.80s: status %d, expected %d", tt.body, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var result struct {
+			Legs []struct {
+				Path []struct{} `json:"path"`
+			} `json:"legs"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Legs) != tt.legs || len(result.Legs[0].Path) != 3 {
+			t.Errorf("%s: %d legs", tt.body, len(result.Legs))
+		}
+	}
+}
+
+func TestGeSegVertex(t *testing.T) {
+	const d2r = math.Pi / 180
+	// over the north pole along the meridian: the vertex is the pole, the minimum is the target
+	for name, nav := range geonavs {
+		source, target := geomys.Geo(80, 0), geomys.Geo(70, 180)
+		g := newgeseg(nav, source, target)
+		v := g.vertex()
+		s, _, _ := nav.inverse(source, geomys.Geo(90, 0))
+		// near the pole the latitude of the spherical solutions is good to about 0.1 m
+		if math.Abs(v.Max.Lat-90) > 1e-5 || math.Abs(v.Max.S-s) > 1 {
+			t.Errorf("%s: transpolar: the maximum is %+v, expected 90 at %.3f m", name, v.Max, s)
+		}
+		if v.Min != (gelatext{70, 180, math.Round(g.s12*1e3) / 1e3}) {
+			t.Errorf("%s: transpolar: the minimum is %+v", name, v.Min)
+		}
+		if v.Antimeridian || !v.NearPole || v.PoleDistance > 1 {
+			t.Errorf("%s: transpolar: %+v", name, v)
+		}
+	}
+	// the great circle leaving the equator at 45 degrees has its vertex at (45,90)
+	nav := geonavs["haversine"]
+	source := geomys.Geo(0, 0)
+	target, _ := nav.direct(source, 45, 15000000)
+	g := newgeseg(nav, source, target)
+	v := g.vertex()
+	s, _, _ := nav.inverse(source, geomys.Geo(45, 90))
+	if math.Abs(v.Max.Lat-45) > 1e-8 || math.Abs(v.Max.Lon-90) > 1e-4 || math.Abs(v.Max.S-s) > 10 {
+		t.Errorf("great circle: the maximum is %+v, expected (45,90) at %.3f m", v.Max, s)
+	}
+	if v.Min != (gelatext{0, 0, 0}) || v.Antimeridian || v.NearPole {
+		t.Errorf("great circle: %+v", v)
+	}
+	// the geodesic leaving the equator at 45 degrees: by Clairaut's relation
+	// its vertex has the reduced latitude 45 degrees and the azimuth 90 degrees there
+	nav = geonavs["geodesic"]
+	target, _ = nav.direct(source, 45, 15000000)
+	g = newgeseg(nav, source, target)
+	v = g.vertex()
+	_, azi := g.at(v.Max.S)
+	if lat := math.Atan(1/(1-wgsF)) / d2r; math.Abs(v.Max.Lat-lat) > 1e-8 || math.Abs(azi-90) > 1e-3 {
+		t.Errorf("geodesic: the maximum is %+v with the azimuth %v, expected the latitude %v", v.Max, azi, lat)
+	}
+	// across the antimeridian: the vertex of the symmetric path is on the antimeridian halfway
+	for name, nav := range geonavs {
+		g := newgeseg(nav, geomys.Geo(50, 170), geomys.Geo(50, -170))
+		v := g.vertex()
+		p, _ := g.at(g.s12 / 2)
+		lat, _ := p.Geo()
+		if math.Abs(v.Max.Lat-lat) > 1e-8 || math.Abs(math.Abs(v.Max.Lon)-180) > 1e-4 || math.Abs(v.Max.S-g.s12/2) > 10 {
+			t.Errorf("%s: antimeridian: the maximum is %+v, expected %v at %.3f m", name, v.Max, lat, g.s12/2)
+		}
+		if v.Min.Lat != 50 || v.Min.Lon != 170 || v.Min.S != 0 || !v.Antimeridian || v.NearPole {
+			t.Errorf("%s: antimeridian: %+v", name, v)
+		}
+	}
+	// near a pole: the northernmost point is the target, within 100 km of the pole or not
+	for _, tt := range []struct {
+		lat  float64
+		near bool
+	}{{89.5, true}, {89, false}} {
+		for name, nav := range geonavs {
+			g := newgeseg(nav, geomys.Geo(85, 10), geomys.Geo(tt.lat, 10))
+			v := g.vertex()
+			d := meridarc(math.Pi/2) - meridarc(tt.lat*d2r)
+			if v.Max != (gelatext{tt.lat, 10, math.Round(g.s12*1e3) / 1e3}) || v.NearPole != tt.near || math.Abs(v.PoleDistance-d) > 1e-3 || v.Antimeridian {
+				t.Errorf("%s: near the pole at %v: %+v", name, tt.lat, v)
+			}
+		}
+	}
+}
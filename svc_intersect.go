@@ -0,0 +1,209 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Intersect -- configures the service for the router `R`.
+func Intersect(R *mux.Router) {
+	R.Handle("/api/intersect", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(usageIntersect))).Methods("GET")
+	R.Handle("/api/intersect/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}/lat3/{lat3}/lon3/{lon3}/lat4/{lat4}/lon4/{lon4}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(intersect))).Methods("GET")
+}
+
+func usageIntersect(w http.ResponseWriter, r *http.Request) {
+	doc := `
+/api/intersect/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}/lat3/{lat3}/lon3/{lon3}/lat4/{lat4}/lon4/{lon4} -- finds where two segments
+of the great ellipse cross: the first segment is from (lat1,lon1) to (lat2,lon2), the second one is from (lat3,lon3) to (lat4,lon4).
+The segments are the shorter arcs of the great ellipses, as in /api/greatell.
+
+Input:
+{lat1},{lat2},{lat3},{lat4} -- the geographic latitudes of the endpoints, must be in [-90,90]
+{lon1},{lon2},{lon3},{lon4} -- the geographic longitudes of the endpoints, must be in [-180,180]
+
+Output:
+{
+ "duration_ms":___,
+ "type":"GreatEllipseIntersection",
+ "intersect":___,
+ "collinear":___,
+ "message":___,
+ "points":[{"lat":___,"lon":___,"s1":___,"s2":___},...]
+}
+
+{intersect} -- true if the segments cross, touch or overlap
+{collinear} -- true if the segments lie on the same great ellipse
+{message} -- why the segments do not cross: "no intersection within segments"
+             or "segments lie on the same great ellipse and do not overlap"
+{points} -- the intersection points (an empty array if there are none);
+            for collinear segments, the endpoints of the overlap (one point if the segments only touch)
+{s1} -- the distance of the point from (lat1,lon1) along the first segment in meters
+{s2} -- the distance of the point from (lat3,lon3) along the second segment in meters
+
+The endpoints of a segment must be distinct and not antipodal.
+`
+	//
+	HS200t(w, []byte(doc))
+}
+
+func intersect(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	vars := mux.Vars(r)
+	//
+	var coords [8]float64
+	for k, name := range []string{"lat1", "lon1", "lat2", "lon2", "lat3", "lon3", "lat4", "lon4"} {
+		x, err := strconv.ParseFloat(vars[name], 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		lim := 90.0
+		if k%2 == 1 {
+			lim = 180
+		}
+		if !(-lim <= x && x <= lim) {
+			HS400(w)
+			return
+		}
+		coords[k] = x
+	}
+	//
+	var ends [4]geomys.Point
+	for k := range ends {
+		ends[k] = geomys.Geo(coords[2*k], coords[2*k+1])
+	}
+	points, collinear, err := geintersect(ends[0], ends[1], ends[2], ends[3])
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	type geo4 struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+		S1  float64 `json:"s1"`
+		S2  float64 `json:"s2"`
+	}
+	nav := geonavs["greatellipse"]
+	result := make([]geo4, len(points))
+	for k, p := range points {
+		lat, lon := p.Geo()
+		s1, _, _ := nav.inverse(ends[0], p)
+		s2, _, _ := nav.inverse(ends[2], p)
+		result[k] = geo4{math.Round(lat*1e8) / 1e8, math.Round(lon*1e8) / 1e8, math.Round(s1*1e3) / 1e3, math.Round(s2*1e3) / 1e3}
+	}
+	message := ""
+	if len(result) == 0 {
+		message = "no intersection within segments"
+		if collinear {
+			message = "segments lie on the same great ellipse and do not overlap"
+		}
+	}
+	//
+	resultx := struct {
+		Duration  int64  `json:"duration_ms"`
+		Type      string `json:"type"`
+		Intersect bool   `json:"intersect"`
+		Collinear bool   `json:"collinear"`
+		Message   string `json:"message,omitempty"`
+		Points    []geo4 `json:"points"`
+	}{time.Since(start).Milliseconds(), "GreatEllipseIntersection", len(result) > 0, collinear, message, result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+// errdegenerate -- the endpoints of a segment are the same or antipodal.
+var errdegenerate = errors.New("segment endpoints must be distinct and not antipodal")
+
+// geintersect -- returns the intersection points of the great ellipse segments p1-p2 and p3-p4.
+// The great ellipse lies in the plane through the center of the ellipsoid and its endpoints,
+// so two great ellipses meet at the two opposite points on the line where their planes meet;
+// those of the points that lie within both segments are returned. If both segments lie
+// on the same great ellipse, true is returned with the endpoints of their overlap in the order along p1-p2.
+func geintersect(p1, p2, p3, p4 geomys.Point) ([]geomys.Point, bool, error) {
+	geocen := geomys.NewGeocentric(geomys.WGS1984())
+	x1, x2 := unit3(geocen.Forward(p1)), unit3(geocen.Forward(p2))
+	x3, x4 := unit3(geocen.Forward(p3)), unit3(geocen.Forward(p4))
+	n1, n2 := cross3(x1, x2), cross3(x3, x4)
+	const eps = 1e-12
+	if norm3(n1) < eps || norm3(n2) < eps {
+		return nil, false, errdegenerate
+	}
+	n1, n2 = unit3(n1), unit3(n2)
+	//
+	// within -- whether the direction `x` is between the directions `a` and `b` in the plane of the normal `n`
+	within := func(x, a, b, n [3]float64) bool {
+		return dot3(cross3(a, x), n) >= -eps && dot3(cross3(x, b), n) >= -eps
+	}
+	d := cross3(n1, n2)
+	if norm3(d) < eps {
+		return geoverlap(within, [4][3]float64{x1, x2, x3, x4}, [4]geomys.Point{p1, p2, p3, p4}, n1, n2), true, nil
+	}
+	d = unit3(d)
+	points := make([]geomys.Point, 0, 1)
+	for _, sign := range []float64{1, -1} {
+		x := [3]float64{sign * d[0], sign * d[1], sign * d[2]}
+		if within(x, x1, x2, n1) && within(x, x3, x4, n2) {
+			// the point of the ellipsoid in the direction of `x`
+			t := 1 / math.Sqrt((x[0]*x[0]+x[1]*x[1])/(wgsA*wgsA)+x[2]*x[2]/(wgsB*wgsB))
+			lat, lon := ecefgeo([3]float64{t * x[0], t * x[1], t * x[2]})
+			points = append(points, geomys.Geo(lat, lon))
+		}
+	}
+	return points, false, nil
+}
+
+// geoverlap -- returns the endpoints of the overlap of two segments on the same great ellipse:
+// the endpoints of either segment that lie within the other one, in the order along the first segment.
+// The segments are shorter than a half of the great ellipse, so the overlap is a single arc.
+func geoverlap(within func(x, a, b, n [3]float64) bool, xs [4][3]float64, ps [4]geomys.Point, n1, n2 [3]float64) []geomys.Point {
+	type end struct {
+		x [3]float64
+		p geomys.Point
+		θ float64
+	}
+	ends := make([]end, 0, 2)
+	for k := range xs {
+		a, b, n := xs[2], xs[3], n2
+		if k >= 2 {
+			a, b, n = xs[0], xs[1], n1
+		}
+		if !within(xs[k], a, b, n) {
+			continue
+		}
+		dup := false
+		for _, e := range ends {
+			dup = dup || norm3([3]float64{e.x[0] - xs[k][0], e.x[1] - xs[k][1], e.x[2] - xs[k][2]}) < 1e-12
+		}
+		if !dup {
+			// the angle from the start of the first segment
+			θ := math.Atan2(dot3(cross3(xs[0], xs[k]), n1), dot3(xs[0], xs[k]))
+			ends = append(ends, end{xs[k], ps[k], θ})
+		}
+	}
+	sort.Slice(ends, func(i, j int) bool { return ends[i].θ < ends[j].θ })
+	points := make([]geomys.Point, len(ends))
+	for k, e := range ends {
+		points[k] = e.p
+	}
+	return points
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeIntersect(t *testing.T) {
+	tests := []struct {
+		name      string
+		ends      [8]float64
+		collinear bool
+		points    []geolatlon
+	}{
+		{"equator and meridian", [8]float64{0, -10, 0, 10, -10, 0, 10, 0}, false, []geolatlon{{0, 0}}},
+		{"apart", [8]float64{10, -10, 10, 10, 20, 5, 30, 5}, false, []geolatlon{}},
+		{"touching", [8]float64{0, 0, 0, 10, 0, 10, 10, 10}, false, []geolatlon{{0, 10}}},
+		{"overlapping", [8]float64{0, -10, 0, 10, 0, 5, 0, 30}, true, []geolatlon{{0, 5}, {0, 10}}},
+		{"contained reversed", [8]float64{0, -10, 0, 10, 0, 8, 0, -5}, true, []geolatlon{{0, -5}, {0, 8}}},
+		{"end to end", [8]float64{0, 0, 0, 10, 0, 10, 0, 20}, true, []geolatlon{{0, 10}}},
+		{"disjoint", [8]float64{0, -10, 0, 10, 0, 20, 0, 30}, true, []geolatlon{}},
+		{"over the pole", [8]float64{80, 0, 80, 180, 85, 180, 70, 180}, true, []geolatlon{{85, 180}, {80, 180}}},
+	}
+	for _, tt := range tests {
+		var ps [4]geomys.Point
+		for k := range ps {
+			ps[k] = geomys.Geo(tt.ends[2*k], tt.ends[2*k+1])
+		}
+		points, collinear, err := geintersect(ps[0], ps[1], ps[2], ps[3])
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if collinear != tt.collinear || len(points) != len(tt.points) {
+			t.Errorf("%s: collinear %v, %d points", tt.name, collinear, len(points))
+			continue
+		}
+		for k, p := range points {
+			lat, lon := p.Geo()
+			if math.Abs(lat-tt.points[k].Lat) > 1e-9 || math.Abs(math.Remainder(lon-tt.points[k].Lon, 360)) > 1e-9 {
+				t.Errorf("%s: point %d is (%v,%v), expected %+v", tt.name, k, lat, lon, tt.points[k])
+			}
+		}
+	}
+	// a crossing near the antimeridian lies in the planes of both great ellipses
+	ps := [4]geomys.Point{geomys.Geo(40, 170), geomys.Geo(50, -170), geomys.Geo(60, 179), geomys.Geo(30, -179)}
+	points, _, err := geintersect(ps[0], ps[1], ps[2], ps[3])
+	if err != nil || len(points) != 1 {
+		t.Fatalf("antimeridian: %d points, %v", len(points), err)
+	}
+	geocen := geomys.NewGeocentric(geomys.WGS1984())
+	x := unit3(geocen.Forward(points[0]))
+	for k := 0; k < 4; k += 2 {
+		n := unit3(cross3(unit3(geocen.Forward(ps[k])), unit3(geocen.Forward(ps[k+1]))))
+		if d := dot3(x, n); math.Abs(d) > 1e-12 {
+			t.Errorf("antimeridian: the point is off the plane of the segment %d by %v", k/2+1, d)
+		}
+	}
+	// degenerate segments
+	for _, ends := range [][4]float64{{10, 10, 10, 10}, {0, 0, 0, 180}} {
+		p1, p2 := geomys.Geo(ends[0], ends[1]), geomys.Geo(ends[2], ends[3])
+		if _, _, err := geintersect(p1, p2, ps[2], ps[3]); err != errdegenerate {
+			t.Errorf("%v: %v", ends, err)
+		}
+	}
+}
+
+func TestIntersectService(t *testing.T) {
+	R := mux.NewRouter()
+	Intersect(R)
+	tests := []struct {
+		path      string
+		code      int
+		intersect bool
+		collinear bool
+		count     int
+	}{
+		{"/api/intersect/lat1/0/lon1/-10/lat2/0/lon2/10/lat3/-10/lon3/0/lat4/10/lon4/0", http.StatusOK, true, false, 1},
+		{"/api/intersect/lat1/10/lon1/-10/lat2/10/lon2/10/lat3/20/lon3/5/lat4/30/lon4/5", http.StatusOK, false, false, 0},
+		{"/api/intersect/lat1/0/lon1/-10/lat2/0/lon2/10/lat3/0/lon3/5/lat4/0/lon4/30", http.StatusOK, true, true, 2},
+		{"/api/intersect/lat1/0/lon1/-10/lat2/0/lon2/10/lat3/0/lon3/20/lat4/0/lon4/30", http.StatusOK, false, true, 0},
+		{"/api/intersect/lat1/0/lon1/10/lat2/0/lon2/10/lat3/0/lon3/20/lat4/0/lon4/30", http.StatusBadRequest, false, false, 0},
+		{"/api/intersect/lat1/0/lon1/10/lat2/0/lon2/10/lat3/0/lon3/20/lat4/0/lon4/181", http.StatusBadRequest, false, false, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, expected %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var result struct {
+			Intersect bool        `json:"intersect"`
+			Collinear bool        `json:"collinear"`
+			Message   string      `json:"message"`
+			Points    []geolatlon `json:"points"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Intersect != tt.intersect || result.Collinear != tt.collinear || len(result.Points) != tt.count {
+			t.Errorf("%s: %+v", tt.path, result)
+		}
+		if !result.Intersect && result.Message == "" {
+			t.Errorf("%s: no message", tt.path)
+		}
+	}
+}
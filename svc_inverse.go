@@ -0,0 +1,273 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/cds"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Inverse -- configures the service for the router `R`.
+func Inverse(R *mux.Router) {
+	R.Handle("/api/inverse", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(usageInverse))).Methods("GET")
+	R.Handle("/api/inverse/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(inverse))).Methods("GET")
+	R.Handle("/api/inverse/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}/midpoint", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(inversemid))).Methods("GET")
+	R.Handle("/api/inverse/batch", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(inversebatch))).Methods("POST")
+	R.Handle("/api/inverse/batch/midpoint", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(inversebatchmid))).Methods("POST")
+}
+
+func usageInverse(w http.ResponseWriter, r *http.Request) {
+	doc := `
+/api/inverse/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}[/midpoint][?method={method}] -- solves the inverse problem:
+returns the distance and the azimuths between two given geographic locations.
+
+[/midpoint] -- also returns the midpoint between the locations
+
+Input:
+{lat1} -- the geographic latitude of the source, must be in [-90,90]
+{lon1} -- the geographic longitude of the source, must be in [-180,180]
+{lat2} -- the geographic latitude of the target, must be in [-90,90]
+{lon2} -- the geographic longitude of the target, must be in [-180,180]
+{method} -- greatellipse (default), geodesic, haversine or andoyer, as in /api/greatell
+
+Output:
+{
+ "duration_ms":___,
+ "method":___,
+ "lat1":___,
+ "lon1":___,
+ "lat2":___,
+ "lon2":___,
+ "distance":___,
+ "azi1":___,
+ "azi2":___,
+ "back_azi":___,
+ "midpoint":{"lat":___,"lon":___}
+}
+
+{distance} -- the distance between the source and the target in meters
+{azi1} -- the forward azimuth at the source (towards the target)
+{azi2} -- the azimuth at the target in the direction of travel
+{back_azi} -- the back azimuth at the target (towards the source)
+{midpoint} -- the location halfway between the source and the target, only with [/midpoint]
+
+/api/inverse/batch[/midpoint][?method={method}] -- (POST) solves the inverse problem for many pairs of locations.
+
+Input:
+{
+ "pairs":[{"id":___,"lat1":___,"lon1":___,"lat2":___,"lon2":___},...]
+}
+
+{pairs} -- 1,...,1000 pairs with distinct ids; the coordinates as above
+
+Output:
+{
+ "duration_ms":___,
+ "method":___,
+ "count":___,
+ "solutions":[{"id":___,"lat1":___,...,"back_azi":___},...]
+}
+`
+	//
+	HS200t(w, []byte(doc))
+}
+
+// invsolution -- a solution of the inverse problem.
+type invsolution struct {
+	Lat1     float64    `json:"lat1"`
+	Lon1     float64    `json:"lon1"`
+	Lat2     float64    `json:"lat2"`
+	Lon2     float64    `json:"lon2"`
+	Distance float64    `json:"distance"`
+	Azi1     float64    `json:"azi1"`
+	Azi2     float64    `json:"azi2"`
+	BackAzi  float64    `json:"back_azi"`
+	Midpoint *geolatlon `json:"midpoint,omitempty"`
+}
+
+// solveinverse -- solves the inverse problem by the method `nav`.
+func solveinverse(nav geonav, lat1, lon1, lat2, lon2 float64, midpoint bool) invsolution {
+	seg := newgeseg(nav, geomys.Geo(lat1, lon1), geomys.Geo(lat2, lon2))
+	back := seg.azi2 + 180
+	if back > 180 {
+		back -= 360
+	}
+	sol := invsolution{lat1, lon1, lat2, lon2, math.Round(seg.s12*1e3) / 1e3, math.Round(seg.azi1*1e8) / 1e8, math.Round(seg.azi2*1e8) / 1e8, math.Round(back*1e8) / 1e8, nil}
+	if midpoint {
+		p, _ := seg.at(seg.s12 / 2)
+		lat, lon := p.Geo()
+		sol.Midpoint = &geolatlon{math.Round(lat*1e8) / 1e8, math.Round(lon*1e8) / 1e8}
+	}
+	return sol
+}
+
+func inverse(w http.ResponseWriter, r *http.Request) {
+	invpair(w, r, false)
+}
+
+func inversemid(w http.ResponseWriter, r *http.Request) {
+	invpair(w, r, true)
+}
+
+func invpair(w http.ResponseWriter, r *http.Request, midpoint bool) {
+	start := time.Now()
+	vars := mux.Vars(r)
+	//
+	lat1, err := strconv.ParseFloat(vars["lat1"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat1 && lat1 <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon1, err := strconv.ParseFloat(vars["lon1"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon1 && lon1 <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	lat2, err := strconv.ParseFloat(vars["lat2"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat2 && lat2 <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon2, err := strconv.ParseFloat(vars["lon2"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon2 && lon2 <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	sol := solveinverse(nav, lat1, lon1, lat2, lon2, midpoint)
+	resultx := struct {
+		Duration int64  `json:"duration_ms"`
+		Method   string `json:"method"`
+		invsolution
+	}{time.Since(start).Milliseconds(), nav.name, sol}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+func inversebatch(w http.ResponseWriter, r *http.Request) {
+	invbatch(w, r, false)
+}
+
+func inversebatchmid(w http.ResponseWriter, r *http.Request) {
+	invbatch(w, r, true)
+}
+
+func invbatch(w http.ResponseWriter, r *http.Request, midpoint bool) {
+	start := time.Now()
+	const NMAX = 1000
+	//
+	type pair struct {
+		Id   string  `json:"id"`
+		Lat1 float64 `json:"lat1"`
+		Lon1 float64 `json:"lon1"`
+		Lat2 float64 `json:"lat2"`
+		Lon2 float64 `json:"lon2"`
+	}
+	var t struct {
+		Pairs []pair `json:"pairs"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&t)
+	if err != nil {
+		// JSON error
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	n := len(t.Pairs)
+	if n == 0 || n > NMAX {
+		// array length error
+		HS400t(w, "array length error")
+		return
+	}
+	//
+	setofid := cds.NewSetOfStr()
+	for _, p := range t.Pairs {
+		if !(-90 <= p.Lat1 && p.Lat1 <= 90 && -180 <= p.Lon1 && p.Lon1 <= 180) {
+			HS400t(w, "coordinate error")
+			return
+		}
+		if !(-90 <= p.Lat2 && p.Lat2 <= 90 && -180 <= p.Lon2 && p.Lon2 <= 180) {
+			HS400t(w, "coordinate error")
+			return
+		}
+		setofid.Extend(p.Id)
+	}
+	if setofid.Card() != n {
+		// repeated ids error
+		HS400t(w, "repeated ids error")
+		return
+	}
+	//
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	type solution struct {
+		Id string `json:"id"`
+		invsolution
+	}
+	result := make([]solution, n)
+	for k, p := range t.Pairs {
+		result[k] = solution{p.Id, solveinverse(nav, p.Lat1, p.Lon1, p.Lat2, p.Lon2, midpoint)}
+	}
+	//
+	resultx := struct {
+		Duration  int64      `json:"duration_ms"`
+		Method    string     `json:"method"`
+		Count     int        `json:"count"`
+		Solutions []solution `json:"solutions"`
+	}{time.Since(start).Milliseconds(), nav.name, n, result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
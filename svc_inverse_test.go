@@ -0,0 +1,62 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInverseBatch(t *testing.T) {
+	R := mux.NewRouter()
+	Inverse(R)
+	body := `{"pairs":[{"id":"a","lat1":0,"lon1":0,"lat2":0,"lon2":1},{"id":"b","lat1":51.47,"lon1":-0.46,"lat2":40.64,"lon2":-73.78}]}`
+	tests := []struct {
+		path  string
+		body  string
+		code  int
+		count int
+	}{
+		{"/api/inverse/batch", body, http.StatusOK, 2},
+		{"/api/inverse/batch/midpoint", body, http.StatusOK, 2},
+		{"/api/inverse/batch", strings.Replace(body, `"b"`, `"a"`, 1), http.StatusBadRequest, 0},
+		{"/api/inverse/batch", `{"pairs":[]}`, http.StatusBadRequest, 0},
+		// the body is limited to the size of 1000 pairs
+		{"/api/inverse/batch", strings.Replace(body, "]}", strings.Repeat(" ", 1<<20)+"]}", 1), http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%s %.80s: status %d, expected %d", tt.path, tt.body, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var result struct {
+			Count     int `json:"count"`
+			Solutions []struct {
+				Id string `json:"id"`
+				invsolution
+			} `json:"solutions"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Count != tt.count || len(result.Solutions) != tt.count || result.Solutions[1].Id != "b" || !(result.Solutions[1].Distance > 5000000) {
+			t.Errorf("%s: %+v", tt.path, result)
+			continue
+		}
+		// the midpoint is reported only if asked for
+		if midpoint := strings.HasSuffix(tt.path, "/midpoint"); (result.Solutions[0].Midpoint != nil) != midpoint {
+			t.Errorf("%s: midpoint %v", tt.path, result.Solutions[0].Midpoint)
+		}
+	}
+}
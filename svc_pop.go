@@ -0,0 +1,536 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PopAgeBucket -- the ages from Lo to Hi years (inclusive) in census records.
+// Hi is -1 for the open-ended last bucket.
+type PopAgeBucket struct {
+	Lo, Hi int
+}
+
+// PopAgesP12 -- the age buckets of table P12 (sex by age) of the US Censuses 2000, 2010 and 2020.
+var PopAgesP12 = []PopAgeBucket{
+	{0, 4}, {5, 9}, {10, 14}, {15, 17}, {18, 19}, {20, 20}, {21, 21}, {22, 24},
+	{25, 29}, {30, 34}, {35, 39}, {40, 44}, {45, 49}, {50, 54}, {55, 59}, {60, 61},
+	{62, 64}, {65, 66}, {67, 69}, {70, 74}, {75, 79}, {80, 84}, {85, -1},
+}
+
+// PopVintage -- configures the data of a census vintage.
+// The geo file and the records have the formats of the Pop2010 service,
+// except that a record has as many age buckets per sex as `Ages`.
+type PopVintage struct {
+	Year      int            // the census year
+	GeoFile   string         // census block locations: id,pop,lat,lon,x,y,z
+	BadgerDir string         // census block records keyed by block id
+	Store     PopStore       // if set, census block records are read from it instead of BadgerDir
+	Ages      []PopAgeBucket // the age buckets of the records (default PopAgesP12)
+}
+
+// PopConfig -- configures the census vintages of the Pop service.
+type PopConfig struct {
+	Vintages []PopVintage
+	Lazy     bool // if true, the data are loaded by the first request instead of by Pop
+}
+
+// popsources -- the census vintages by year.
+// The Pop2010 service adds its data as the 2010 vintage.
+var popsources struct {
+	sync.Mutex
+	m map[int]*popsource
+}
+
+// addpopsource -- adds the vintage of `src` to the Pop service.
+func addpopsource(src *popsource) error {
+	popsources.Lock()
+	defer popsources.Unlock()
+	if popsources.m == nil {
+		popsources.m = make(map[int]*popsource)
+	}
+	year := src.vintage.Year
+	if s, ok := popsources.m[year]; ok && s != src {
+		return fmt.Errorf("census vintage %d is configured twice", year)
+	}
+	popsources.m[year] = src
+	return nil
+}
+
+// lookuppopsource -- returns the source of the vintage `year`, or nil.
+func lookuppopsource(year int) *popsource {
+	popsources.Lock()
+	defer popsources.Unlock()
+	return popsources.m[year]
+}
+
+// checkpopages -- checks that the age buckets start at 0 and follow each other without gaps.
+func checkpopages(ages []PopAgeBucket) error {
+	if len(ages) == 0 {
+		return errors.New("no age buckets")
+	}
+	next := 0
+	for k, a := range ages {
+		if a.Lo != next {
+			return fmt.Errorf("age bucket %d does not start at %d", k, next)
+		}
+		if a.Hi < 0 {
+			if k != len(ages)-1 {
+				return errors.New("only the last age bucket can be open-ended")
+			}
+			break
+		}
+		if a.Hi < a.Lo {
+			return fmt.Errorf("age bucket %d is empty", k)
+		}
+		next = a.Hi + 1
+	}
+	return nil
+}
+
+// agelabel -- the label of an age bucket, as in the Pop2010 pyramid: under5, 5to9, 20, 85over.
+func agelabel(a PopAgeBucket) string {
+	switch {
+	case a.Hi < 0:
+		return fmt.Sprintf("%dover", a.Lo)
+	case a.Lo == 0:
+		return fmt.Sprintf("under%d", a.Hi+1)
+	case a.Lo == a.Hi:
+		return strconv.Itoa(a.Lo)
+	}
+	return fmt.Sprintf("%dto%d", a.Lo, a.Hi)
+}
+
+// Pop -- configures the service for the router `R`.
+// Unless `cfg.Lazy` is set, the data are loaded before the routes are added,
+// and a loading error is returned.
+func Pop(R *mux.Router, cfg PopConfig) error {
+	for _, v := range cfg.Vintages {
+		if v.Ages == nil {
+			v.Ages = PopAgesP12
+		}
+		if err := checkpopages(v.Ages); err != nil {
+			return fmt.Errorf("census vintage %d: %v", v.Year, err)
+		}
+		if v.GeoFile == "" || (v.Store == nil && v.BadgerDir == "") {
+			return fmt.Errorf("census vintage %d: no data files", v.Year)
+		}
+		src := &popsource{vintage: v}
+		if err := addpopsource(src); err != nil {
+			return err
+		}
+		if !cfg.Lazy {
+			ds, err := src.dataset()
+			if err != nil {
+				return fmt.Errorf("census vintage %d: %v", v.Year, err)
+			}
+			ds.release()
+		}
+	}
+	//
+	R.Handle("/api/pop", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(usagePop))).Methods("GET")
+	R.Handle("/api/pop/vintages", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(popvintages))).Methods("GET")
+	R.Handle("/api/pop/{vintage}/{distance}/lat/{lat}/lon/{lon}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(popvintage))).Methods("GET")
+	R.Handle("/api/pop/compare/{vintage1}/{vintage2}/{distance}/lat/{lat}/lon/{lon}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(popcompare))).Methods("GET")
+	return nil
+}
+
+func usagePop(w http.ResponseWriter, r *http.Request) {
+	doc := `
+/api/pop/vintages -- returns the census vintages served and their age buckets.
+
+Output:
+{
+ "vintages":
+  [
+   {"vintage":___,"ages":["under5","5to9",...,"85over"]},...
+  ]
+}
+
+/api/pop/{vintage}/{distance}/lat/{lat}/lon/{lon} -- returns the population (US Census {vintage}) within the given distance from the given location.
+
+Input:
+{vintage} -- the census year, e.g. 2010
+{distance} -- the search radius in meters, must be in [1,1000000]
+{lat} -- the geographic latitude, must be in [-90,90]
+{lon} -- the geographic longitude, must be in [-180,180]
+
+Output:
+{
+ "duration_ms":___,
+ "distance":___,
+ "lat":___,
+ "lon":___,
+ "vintage":___,
+ "blocks":___,
+ "pop":___,
+ "pop_female":___,
+ "pop_male":___,
+ "ages_female":[{"age":"under5","count":___},...],
+ "ages_male":[{"age":"under5","count":___},...]
+}
+
+{blocks} -- US Census block count within the given distance
+{ages_female},{ages_male} -- the population by the age buckets of the vintage
+
+/api/pop/compare/{vintage1}/{vintage2}/{distance}/lat/{lat}/lon/{lon} -- returns the change of the population from {vintage1} to {vintage2} within the given distance from the given location.
+
+Input:
+{vintage1},{vintage2} -- the census years, e.g. 2000 and 2010
+{distance},{lat},{lon} -- as above
+
+Output:
+{
+ "duration_ms":___,
+ "distance":___,
+ "lat":___,
+ "lon":___,
+ "vintage1":{"vintage":___,"blocks":___,"pop":___,...},
+ "vintage2":{"vintage":___,"blocks":___,"pop":___,...},
+ "change":
+  {
+   "pop":___,
+   "pop_female":___,
+   "pop_male":___,
+   "pop_percent":___,
+   "ages_female":[{"age":"under5","count":___},...],
+   "ages_male":[{"age":"under5","count":___},...]
+  }
+}
+
+{vintage1},{vintage2} -- the population of each vintage, as above
+{change} -- the population of {vintage2} minus the population of {vintage1}
+{pop_percent} -- the change of the population in percent of {vintage1} (null if {vintage1} has no population)
+{ages_female},{ages_male} -- the change by age bucket, only if both vintages have the same age buckets
+Census blocks differ between vintages; the blocks of each vintage are found separately.
+
+Age options (query string):
+
+?ages={bands} -- also reports the population in the given age bands as
+                 "agebands_female":[{"age":___,"count":___},...] and "agebands_male":[...]
+{bands} -- Ny for the bands of N years, e.g. 5y or 10y (the last band is open-ended),
+           or comma-separated bands [name:]lo-hi, [name:]lo- (open-ended) or [name:]age,
+           e.g. children:0-17,adults:18-64,seniors:65-; the bands must increase,
+           and their ages must start and end where the census age groups do;
+           a band without a name is named by its ages, e.g. under18, 18to64, 65over
+?raw=false -- omits the census age groups "ages_female" and "ages_male"
+The age bands of /api/pop/compare must match the age groups of both vintages;
+their change is reported in {change} as well.
+`
+	//
+	HS200t(w, []byte(doc))
+}
+
+// popagecount -- the population of an age bucket.
+type popagecount struct {
+	Age   string `json:"age"`
+	Count int    `json:"count"`
+}
+
+// vpopcount -- the population of a set of census blocks of a vintage.
+type vpopcount struct {
+	Vintage int           `json:"vintage"`
+	Blocks  int           `json:"blocks"`
+	Pop     int           `json:"pop"`
+	Fpop    int           `json:"pop_female"`
+	Mpop    int           `json:"pop_male"`
+	Fages   []popagecount `json:"ages_female,omitempty"`
+	Mages   []popagecount `json:"ages_male,omitempty"`
+	Fbands  []popagecount `json:"agebands_female,omitempty"`
+	Mbands  []popagecount `json:"agebands_male,omitempty"`
+}
+
+// mkpopages -- labels the counts of the age buckets `ages`.
+func mkpopages(ages []PopAgeBucket, counts []int) []popagecount {
+	result := make([]popagecount, len(ages))
+	for k, a := range ages {
+		result[k] = popagecount{agelabel(a), counts[k]}
+	}
+	return result
+}
+
+// ages -- returns the age buckets of the vintage of `src`.
+func (src *popsource) ages() []PopAgeBucket {
+	src.Lock()
+	defer src.Unlock()
+	return src.vintage.Ages
+}
+
+// popwithin -- returns the population of the vintage `year` of `src` within `dist` of `query`.
+// The population by age is reported as requested by `opts`.
+func popwithin(src *popsource, year int, query geomys.Point, dist float64, opts popageopts) (vpopcount, []PopAgeBucket, error) {
+	ds, err := src.dataset()
+	if err != nil {
+		return vpopcount{}, nil, err
+	}
+	defer ds.release()
+	//
+	sums, err := popsumgroups(ds.store, [][]string{geosearch(ds.index, query, dist)}, len(ds.ages))
+	if err != nil {
+		return vpopcount{}, nil, err
+	}
+	c := sums[0]
+	count := vpopcount{year, c.blocks, c.pop, c.fpop, c.mpop, nil, nil, mkagebands(opts.bands, c.fpyr), mkagebands(opts.bands, c.mpyr)}
+	if opts.raw {
+		count.Fages, count.Mages = mkpopages(ds.ages, c.fpyr), mkpopages(ds.ages, c.mpyr)
+	}
+	return count, ds.ages, nil
+}
+
+func popvintages(w http.ResponseWriter, r *http.Request) {
+	type vintage struct {
+		Vintage int      `json:"vintage"`
+		Ages    []string `json:"ages"`
+	}
+	vintages := make([]vintage, 0)
+	popsources.Lock()
+	for year, src := range popsources.m {
+		src.Lock()
+		ages := make([]string, len(src.vintage.Ages))
+		for k, a := range src.vintage.Ages {
+			ages[k] = agelabel(a)
+		}
+		src.Unlock()
+		vintages = append(vintages, vintage{year, ages})
+	}
+	popsources.Unlock()
+	sort.Slice(vintages, func(i, j int) bool {
+		return vintages[i].Vintage < vintages[j].Vintage
+	})
+	//
+	resultx := struct {
+		Vintages []vintage `json:"vintages"`
+	}{vintages}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+func popvintage(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	//
+	vars := mux.Vars(r)
+	vintage, err := strconv.ParseInt(vars["vintage"], 10, 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	src := lookuppopsource(int(vintage))
+	if src == nil {
+		HS400t(w, "unknown census vintage")
+		return
+	}
+	//
+	distance, err := strconv.ParseInt(vars["distance"], 10, 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(1 <= distance && distance <= 1000000) {
+		HS400(w)
+		return
+	}
+	//
+	lat, err := strconv.ParseFloat(vars["lat"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat && lat <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon, err := strconv.ParseFloat(vars["lon"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon && lon <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	opts, err := parseageopts(r, src.ages())
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	count, _, err := popwithin(src, int(vintage), geomys.Geo(lat, lon), float64(distance), opts)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	resultx := struct {
+		Duration int64   `json:"duration_ms"`
+		Distance int64   `json:"distance"`
+		Lat      float64 `json:"lat"`
+		Lon      float64 `json:"lon"`
+		vpopcount
+	}{time.Since(start).Milliseconds(), distance, lat, lon, count}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+func popcompare(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	//
+	vars := mux.Vars(r)
+	var vintages [2]int
+	var srcs [2]*popsource
+	var opts [2]popageopts
+	for k, name := range []string{"vintage1", "vintage2"} {
+		vintage, err := strconv.ParseInt(vars[name], 10, 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		vintages[k], srcs[k] = int(vintage), lookuppopsource(int(vintage))
+		if srcs[k] == nil {
+			HS400t(w, "unknown census vintage")
+			return
+		}
+		// the age bands must match the age buckets of both vintages
+		opts[k], err = parseageopts(r, srcs[k].ages())
+		if err != nil {
+			HS400t(w, fmt.Sprintf("census vintage %d: %v", vintages[k], err))
+			return
+		}
+	}
+	//
+	distance, err := strconv.ParseInt(vars["distance"], 10, 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(1 <= distance && distance <= 1000000) {
+		HS400(w)
+		return
+	}
+	//
+	lat, err := strconv.ParseFloat(vars["lat"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat && lat <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon, err := strconv.ParseFloat(vars["lon"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon && lon <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	query := geomys.Geo(lat, lon)
+	count1, ages1, err := popwithin(srcs[0], vintages[0], query, float64(distance), opts[0])
+	if err != nil {
+		HS500(w)
+		return
+	}
+	count2, ages2, err := popwithin(srcs[1], vintages[1], query, float64(distance), opts[1])
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	type popchange struct {
+		Pop    int           `json:"pop"`
+		Fpop   int           `json:"pop_female"`
+		Mpop   int           `json:"pop_male"`
+		PopPct *float64      `json:"pop_percent"`
+		Fages  []popagecount `json:"ages_female,omitempty"`
+		Mages  []popagecount `json:"ages_male,omitempty"`
+		Fbands []popagecount `json:"agebands_female,omitempty"`
+		Mbands []popagecount `json:"agebands_male,omitempty"`
+	}
+	change := popchange{Pop: count2.Pop - count1.Pop, Fpop: count2.Fpop - count1.Fpop, Mpop: count2.Mpop - count1.Mpop}
+	if count1.Pop > 0 {
+		pct := math.Round(float64(change.Pop)/float64(count1.Pop)*1e4) / 1e2
+		change.PopPct = &pct
+	}
+	if opts[0].raw && sameages(ages1, ages2) {
+		change.Fages = popagechange(count1.Fages, count2.Fages)
+		change.Mages = popagechange(count1.Mages, count2.Mages)
+	}
+	// the same age bands are given for both vintages
+	change.Fbands = popagechange(count1.Fbands, count2.Fbands)
+	change.Mbands = popagechange(count1.Mbands, count2.Mbands)
+	//
+	resultx := struct {
+		Duration int64     `json:"duration_ms"`
+		Distance int64     `json:"distance"`
+		Lat      float64   `json:"lat"`
+		Lon      float64   `json:"lon"`
+		Vintage1 vpopcount `json:"vintage1"`
+		Vintage2 vpopcount `json:"vintage2"`
+		Change   popchange `json:"change"`
+	}{time.Since(start).Milliseconds(), distance, lat, lon, count1, count2, change}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+// popagechange -- returns the counts `b` minus the counts `a` by age.
+func popagechange(a, b []popagecount) []popagecount {
+	if len(a) == 0 {
+		return nil
+	}
+	result := make([]popagecount, len(a))
+	for k := range a {
+		result[k] = popagecount{a[k].Age, b[k].Count - a[k].Count}
+	}
+	return result
+}
+
+// sameages -- reports whether `a` and `b` are the same age buckets.
+func sameages(a, b []PopAgeBucket) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
@@ -6,25 +6,85 @@ package svc
 
 import (
 	"bufio"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
-	"github.com/dgraph-io/badger"
+	"fmt"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/reconditematter/geomys"
 	"io"
+	"log"
 	"math"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Pop2010Config -- configures the data sources of the Pop2010 service.
+type Pop2010Config struct {
+	GeoFile   string   // census block locations: id,pop,lat,lon,x,y,z (default "nozgeo.txt")
+	BadgerDir string   // census block records keyed by block id (default "./bddb")
+	Store     PopStore // if set, census block records are read from it instead of BadgerDir
+	Lazy      bool     // if true, the data are loaded by the first request instead of by Pop2010
+	//
+	AdminReload    bool // if true, POST /api/pop2010/reload reloads the data in the background
+	ReloadOnSIGHUP bool // if true, SIGHUP reloads the data in the background
+}
+
 // Pop2010 -- configures the service for the router `R`.
-func Pop2010(R *mux.Router) {
+// Unless `cfg.Lazy` is set, the data are loaded before the routes are added,
+// and a loading error is returned.
+func Pop2010(R *mux.Router, cfg Pop2010Config) error {
+	v := PopVintage{2010, cfg.GeoFile, cfg.BadgerDir, cfg.Store, PopAgesP12}
+	if v.GeoFile == "" {
+		v.GeoFile = geofilename
+	}
+	if v.BadgerDir == "" {
+		v.BadgerDir = popbddbname
+	}
+	popds.Lock()
+	popds.vintage = v
+	popds.Unlock()
+	// the data are also served as the 2010 vintage of the Pop service
+	if err := addpopsource(&popds); err != nil {
+		return err
+	}
+	if !cfg.Lazy {
+		ds, err := pop2010data()
+		if err != nil {
+			return err
+		}
+		ds.release()
+	}
+	if cfg.ReloadOnSIGHUP {
+		pop2010sighup()
+	}
+	//
 	R.Handle("/api/pop2010", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(usagePop2010))).Methods("GET")
 	R.Handle("/api/pop2010/{distance}/lat/{lat}/lon/{lon}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010))).Methods("GET")
+	R.Handle("/api/pop2010/bands/{edges}/lat/{lat}/lon/{lon}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010bands))).Methods("GET")
+	R.Handle("/api/pop2010/reach/{thresholds}/lat/{lat}/lon/{lon}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010reach))).Methods("GET")
+	R.Handle("/api/pop2010/batch", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010batch))).Methods("POST")
+	R.Handle("/api/pop2010/density/grid/{step}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010gridjson))).Methods("GET")
+	R.Handle("/api/pop2010/density/grid/{step}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}/png", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010gridgray))).Methods("GET")
+	R.Handle("/api/pop2010/density/grid/{step}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}/png/heat", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010gridheat))).Methods("GET")
+	R.Handle("/api/pop2010/density/geohash/{length}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010geohash))).Methods("GET")
+	R.Handle("/api/pop2010/corridor", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010corridor))).Methods("POST")
+	R.Handle("/api/pop2010/nearest/{count}/lat/{lat}/lon/{lon}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010nearestjson))).Methods("GET")
+	R.Handle("/api/pop2010/nearest/{count}/lat/{lat}/lon/{lon}/geojson", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010nearestgeojson))).Methods("GET")
+	R.Handle("/api/pop2010/polygon", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010polygon))).Methods("POST")
+	R.Handle("/api/pop2010/version", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010version))).Methods("GET")
+	if cfg.AdminReload {
+		R.Handle("/api/pop2010/reload", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(pop2010reload))).Methods("POST")
+	}
+	return nil
 }
 
 func usagePop2010(w http.ResponseWriter, r *http.Request) {
@@ -47,10 +107,304 @@ Output:
  "pop2010_female":___,
  "pop2010_male":___,
  "ages_female":{"age_under5":___,"age_5to9":___,...,"age_85over":___},
- "ages_male":{"age_under5":___,"age_5to9":___,...,"age_85over":___}
+ "ages_male":{"age_under5":___,"age_5to9":___,...,"age_85over":___},
+ "center":{"lat":___,"lon":___},
+ "standard_distance":___,
+ "median_distance":___
 }
 
 {blocks} -- US Census block count within the given distance
+{center} -- the population-weighted mean center of the blocks (null if there is no population)
+{standard_distance} -- the population-weighted root mean square distance of the blocks from {center} in meters
+{median_distance} -- the distance in meters from the given location within which half of the population lives
+
+/api/pop2010/bands/{edges}/lat/{lat}/lon/{lon} -- returns the population (US Census 2010) in concentric distance bands around the given location.
+
+Input:
+{edges} -- the comma-separated band edges in meters, e.g. 5000,10000,25000;
+           increasing, at most 20, each in [1,1000000]; the innermost band starts at 0,
+           which may also be given as the first edge
+{lat} -- the geographic latitude, must be in [-90,90]
+{lon} -- the geographic longitude, must be in [-180,180]
+
+Output:
+{
+ "duration_ms":___,
+ "lat":___,
+ "lon":___,
+ "bands":
+  [
+   {
+    "from":___,
+    "to":___,
+    "blocks":___,
+    "pop2010":___,
+    "pop2010_female":___,
+    "pop2010_male":___,
+    "ages_female":{...},
+    "ages_male":{...}
+   },...
+  ]
+}
+
+{from},{to} -- a band contains the blocks at distance d from the location, {from} < d <= {to}
+               (the innermost band includes d = 0)
+
+/api/pop2010/reach/{thresholds}/lat/{lat}/lon/{lon} -- returns the radius around the given location needed to reach the given population (US Census 2010).
+
+Input:
+{thresholds} -- the comma-separated population thresholds, e.g. 50000,100000,1000000;
+                at most 20, each in [1,100000000]
+{lat} -- the geographic latitude, must be in [-90,90]
+{lon} -- the geographic longitude, must be in [-180,180]
+
+Output:
+{
+ "duration_ms":___,
+ "lat":___,
+ "lon":___,
+ "reach":
+  [
+   {
+    "population":___,
+    "reached":___,
+    "radius":___,
+    "blocks":___,
+    "pop2010":___
+   },...
+  ]
+}
+
+{radius} -- the distance in meters to the block where the cumulative population first reaches {population}
+{blocks},{pop2010} -- the block count and the cumulative population within {radius}
+{reached} -- false if {population} is not reached within 2000000 meters;
+             then {radius} is the search limit and {blocks},{pop2010} are the totals within it
+
+/api/pop2010/batch -- (POST) returns the population (US Census 2010) within the given distances from many locations.
+
+Input:
+{
+ "sites": [{"id":___,"lat":___,"lon":___,"distance":___},...]
+}
+
+at most 1000 sites with distinct ids; {lat},{lon},{distance} are as above;
+the sites together may cover at most 2000000 blocks (a block is counted once for every site it is near)
+
+Output:
+{
+ "duration_ms":___,
+ "count":___,
+ "sites":
+  [
+   {
+    "id":___,
+    "distance":___,
+    "lat":___,
+    "lon":___,
+    "blocks":___,
+    "pop2010":___,
+    "pop2010_female":___,
+    "pop2010_male":___,
+    "ages_female":{...},
+    "ages_male":{...}
+   },...
+  ]
+}
+
+/api/pop2010/density/grid/{step}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}[/png[/heat]] -- returns the population (US Census 2010) in the cells of a regular grid.
+/api/pop2010/density/geohash/{length}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2} -- returns the population (US Census 2010) in geohash cells.
+
+[/png] -- returns the grid as a grayscale PNG image: one pixel per cell, north up,
+         logarithmic scale, empty cells are transparent
+[/png/heat] -- the same with a black-red-yellow-white colormap
+
+Input:
+{step} -- the grid cell size in degrees, must be in [0.001,10]; at most 1000000 cells
+{length} = 3,5,7,9 -- the length of the geohash; the bounding box may meet at most 1000000 cells
+{lat1},{lon1} -- the south-west corner of the bounding box
+{lat2},{lon2} -- the north-east corner of the bounding box, {lat1} < {lat2} and {lon1} < {lon2}
+
+Output (grid):
+{
+ "duration_ms":___,
+ "min":{"lat":___,"lon":___},
+ "max":{"lat":___,"lon":___},
+ "step":___,
+ "rows":___,
+ "cols":___,
+ "blocks":___,
+ "pop2010":___,
+ "pop2010_max":___,
+ "grid":[[___,...],...]
+}
+
+{grid} -- {rows} rows from south to north, each with {cols} cells from west to east;
+          the cell [i][j] covers [{lat1}+i*{step},{lat1}+(i+1)*{step}]x[{lon1}+j*{step},{lon1}+(j+1)*{step}]
+{pop2010_max} -- the largest cell population
+
+Output (geohash):
+{
+ "duration_ms":___,
+ "min":{"lat":___,"lon":___},
+ "max":{"lat":___,"lon":___},
+ "length":___,
+ "res_d":___,
+ "blocks":___,
+ "pop2010":___,
+ "count":___,
+ "cells":[{"geohash":___,"lat":___,"lon":___,"blocks":___,"pop2010":___},...]
+}
+
+{cells} -- the non-empty geohash cells in the order of their geohashes
+
+/api/pop2010/corridor -- (POST) returns the population (US Census 2010) within the given distance from a route.
+
+Input:
+{
+ "buffer":___,
+ "waypoints":[{"lat":___,"lon":___},...]
+}
+
+{buffer} -- the distance from the route in meters, must be in [1,100000]
+{waypoints} -- 2,...,100 locations; consecutive waypoints are joined by great ellipse segments
+
+Output:
+{
+ "duration_ms":___,
+ "buffer":___,
+ "length":___,
+ "waypoints":___,
+ "blocks":___,
+ "pop2010":___,
+ "pop2010_female":___,
+ "pop2010_male":___,
+ "ages_female":{...},
+ "ages_male":{...},
+ "segments":
+  [
+   {
+    "from":{"lat":___,"lon":___},
+    "to":{"lat":___,"lon":___},
+    "length":___,
+    "blocks":___,
+    "pop2010":___,
+    "pop2010_female":___,
+    "pop2010_male":___,
+    "ages_female":{...},
+    "ages_male":{...}
+   },...
+  ]
+}
+
+{length} -- the length of the route (a segment) in meters
+A block is counted once, in the segment closest to it.
+
+/api/pop2010/nearest/{count}/lat/{lat}/lon/{lon}[/geojson] -- returns the census blocks (US Census 2010) nearest to the given location.
+
+[/geojson] -- returns a GeoJSON FeatureCollection of Point features with the block properties
+
+Input:
+{count} = 1,...,1000 -- the number of blocks
+{lat} -- the geographic latitude, must be in [-90,90]
+{lon} -- the geographic longitude, must be in [-180,180]
+
+Output:
+{
+ "duration_ms":___,
+ "lat":___,
+ "lon":___,
+ "count":___,
+ "blocks":
+  [
+   {
+    "id":___,
+    "lat":___,
+    "lon":___,
+    "distance":___,
+    "pop2010":___,
+    "pop2010_female":___,
+    "pop2010_male":___,
+    "ages_female":{...},
+    "ages_male":{...}
+   },...
+  ]
+}
+
+{blocks} -- ordered by {distance} in meters; only blocks within 2000000 meters are returned
+
+/api/pop2010/polygon -- (POST) returns the population (US Census 2010) within the given polygon(s).
+
+Input:
+a GeoJSON Polygon or MultiPolygon geometry, or a Feature with such a geometry
+{
+ "type":"Polygon",
+ "coordinates":[[[{lon1},{lat1}],[{lon2},{lat2}],...,[{lon1},{lat1}]],...]
+}
+
+Output:
+{
+ "duration_ms":___,
+ "type":___,
+ "polygons":___,
+ "vertices":___,
+ "blocks":___,
+ "pop2010":___,
+ "pop2010_female":___,
+ "pop2010_male":___,
+ "ages_female":{...},
+ "ages_male":{...}
+}
+
+{blocks} -- US Census block count whose locations are inside the polygon(s);
+            the first ring of a polygon is its boundary, other rings are holes
+
+The polygons may have at most 100000 vertices in all. Every polygon must lie within 1000000 meters
+of the center of its bounding box, and the number of blocks in its bounding box times the number
+of its vertices must not exceed 200000000. A polygon that crosses the antimeridian must be split
+there into a MultiPolygon (RFC 7946, 3.1.9).
+
+Age options (query string) of the services that report the population by age:
+
+?ages={bands} -- also reports the population in the given age bands as
+                 "agebands_female":[{"age":___,"count":___},...] and "agebands_male":[...]
+{bands} -- Ny for the bands of N years, e.g. 5y or 10y (the last band is open-ended),
+           or comma-separated bands [name:]lo-hi, [name:]lo- (open-ended) or [name:]age,
+           e.g. children:0-17,adults:18-64,seniors:65-; the bands must increase,
+           and their ages must start and end where the census age groups do;
+           a band without a name is named by its ages, e.g. under18, 18to64, 65over
+?raw=false -- omits the census age groups "ages_female" and "ages_male"
+
+/api/pop2010/version -- returns the version of the data used by the service.
+
+Output:
+{
+ "generation":___,
+ "loaded":___,
+ "geofile":___,
+ "geofile_sha256":___,
+ "geofile_modified":___,
+ "blocks":___,
+ "reloading":___,
+ "reload_error":___
+}
+
+{generation} -- 1 for the data loaded first, incremented by each reload; 0 if the data are not loaded yet
+{loaded} -- the time when the data were loaded (RFC 3339)
+{geofile} -- the base name of the geo file; the paths of the data are in the server log
+{geofile_sha256} -- the SHA-256 digest of the geo file (hex)
+{reload_error} -- "the data could not be loaded" if the last reload failed (the error is in the server log), or null
+
+POST /api/pop2010/reload -- reloads the data from the configured locations in the background
+(only if enabled by the configuration). Requests in progress finish with the data they started with.
+
+Output:
+{
+ "reloading":true,
+ "generation":___
+}
+
+{generation} -- the generation of the data in use when the reload started
+The service answers with status 409 if a reload is in progress.
 `
 	//
 	HS200t(w, []byte(doc))
@@ -63,27 +417,175 @@ type poploc struct {
 	x, y, z  int
 }
 
-var poplocs []poploc
-var popbddb *badger.DB
+// popdataset -- the census data of a vintage.
+// Requests hold a reference to the dataset they started with, so a reloaded
+// dataset replaces it without disturbing them; the old store is closed
+// when the last of these requests is done.
+type popdataset struct {
+	locs       []poploc
+	index      *popindex
+	store      PopStore
+	ownstore   bool // the store was opened by loadpopdataset
+	ages       []PopAgeBucket
+	generation int
+	loaded     time.Time
+	geofile    string // the base name of the geo file
+	geosum     string // the SHA-256 digest of the geo file
+	geomod     time.Time
+	refs       sync.WaitGroup
+}
+
+// popsource -- the configuration and the (possibly not yet loaded) data of a vintage.
+type popsource struct {
+	sync.Mutex
+	vintage    PopVintage
+	data       *popdataset
+	load       *popload // the first load in progress
+	generation int
+	reloading  bool
+	reloaderr  error
+}
+
+// popload -- a load of the data shared by the requests that wait for it;
+// `done` is closed when the load is over.
+type popload struct {
+	done chan struct{}
+	err  error
+}
+
+// popds -- the source of the Pop2010 service.
+var popds popsource
 
 const geofilename = "nozgeo.txt"
 const popbddbname = "./bddb"
 
-func init() {
-	var err error
-	poplocs = loadpoplocs(geofilename)
-	popbddb, err = badger.Open(badger.DefaultOptions(popbddbname).WithReadOnly(true).WithLoggingLevel(2))
+// pop2010data -- returns the live data of the Pop2010 service, loading them on the first call.
+// The caller must call `release` on the returned dataset when it is done with it.
+func pop2010data() (*popdataset, error) {
+	return popds.dataset()
+}
+
+// dataset -- returns the live data of `src`, loading them on the first call.
+// The data are loaded without holding the lock, by one call at a time;
+// the calls that come meanwhile wait for it and share its result.
+// The caller must call `release` on the returned dataset when it is done with it.
+func (src *popsource) dataset() (*popdataset, error) {
+	src.Lock()
+	defer src.Unlock()
+	if src.data == nil {
+		ld := src.load
+		if ld == nil {
+			ld = &popload{done: make(chan struct{})}
+			src.load = ld
+			v := src.vintage
+			src.Unlock()
+			ds, err := loadpopdataset(v)
+			src.Lock()
+			src.load = nil
+			if err == nil {
+				if src.data == nil {
+					src.publish(ds)
+				} else {
+					// a reload has made other data live meanwhile
+					ds.close()
+				}
+			}
+			ld.err = err
+			close(ld.done)
+		} else {
+			src.Unlock()
+			<-ld.done
+			src.Lock()
+		}
+		if src.data == nil {
+			return nil, ld.err
+		}
+	}
+	src.data.refs.Add(1)
+	return src.data, nil
+}
+
+// publish -- makes `ds` the live data of `src`. The store of the replaced data
+// is closed when the last request that uses them is done.
+// The caller must hold the lock of `src`.
+func (src *popsource) publish(ds *popdataset) {
+	src.generation++
+	ds.generation = src.generation
+	old := src.data
+	src.data = ds
+	if old != nil {
+		// no new references to the old data can be taken from here on
+		go func() {
+			old.refs.Wait()
+			old.close()
+		}()
+	}
+}
+
+// close -- closes the store of `ds` if it was opened by loadpopdataset.
+func (ds *popdataset) close() {
+	if ds.ownstore {
+		ds.store.Close()
+	}
+}
+
+// release -- drops a reference obtained from dataset.
+func (ds *popdataset) release() {
+	ds.refs.Done()
+}
+
+func loadpopdataset(v PopVintage) (*popdataset, error) {
+	fi, err := os.Stat(v.GeoFile)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	locs, geosum, err := loadpoplocsum(v.GeoFile)
+	if err != nil {
+		return nil, err
+	}
+	store, ownstore := v.Store, false
+	if store == nil {
+		store, err = OpenBadgerPopStore(v.BadgerDir)
+		if err != nil {
+			return nil, err
+		}
+		ownstore = true
 	}
+	// the paths are only logged, the version of the data tells the base name and the digest
+	if ownstore {
+		log.Printf("pop%d: loaded %d blocks from %s (sha256 %s) and %s", v.Year, len(locs), v.GeoFile, geosum, v.BadgerDir)
+	} else {
+		log.Printf("pop%d: loaded %d blocks from %s (sha256 %s)", v.Year, len(locs), v.GeoFile, geosum)
+	}
+	//
+	return &popdataset{
+		locs:     locs,
+		index:    newpopindex(locs),
+		store:    store,
+		ownstore: ownstore,
+		ages:     v.Ages,
+		loaded:   time.Now(),
+		geofile:  filepath.Base(v.GeoFile),
+		geosum:   geosum,
+		geomod:   fi.ModTime(),
+	}, nil
+}
+
+func loadpoplocs(name string) ([]poploc, error) {
+	locs, _, err := loadpoplocsum(name)
+	return locs, err
 }
 
-func loadpoplocs(name string) []poploc {
+// loadpoplocsum -- reads the geo file `name` like loadpoplocs and returns its SHA-256 digest as well.
+func loadpoplocsum(name string) ([]poploc, string, error) {
 	file, err := os.Open(name)
 	if err != nil {
-		panic(err)
+		return nil, "", err
 	}
-	rdr := csv.NewReader(bufio.NewReader(file))
+	defer file.Close()
+	sum := sha256.New()
+	rdr := csv.NewReader(bufio.NewReader(io.TeeReader(file, sum)))
+	rdr.FieldsPerRecord = 7
 	locs := make([]poploc, 0)
 	for {
 		rec, err := rdr.Read()
@@ -91,30 +593,39 @@ func loadpoplocs(name string) []poploc {
 			break
 		}
 		if err != nil {
-			panic(err)
+			return nil, "", fmt.Errorf("%s: %v", name, err)
 		}
 		//
-		loc := poploc{rec[0], musti(rec[1]), mustf(rec[2]), mustf(rec[3]), musti(rec[4]), musti(rec[5]), musti(rec[6])}
+		var p numparser
+		loc := poploc{rec[0], p.int(rec[1]), p.float(rec[2]), p.float(rec[3]), p.int(rec[4]), p.int(rec[5]), p.int(rec[6])}
+		if p.err != nil {
+			return nil, "", fmt.Errorf("%s: block %s: %v", name, rec[0], p.err)
+		}
 		locs = append(locs, loc)
 	}
 	//
-	return locs
+	return locs, hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// numparser -- parses numeric fields and remembers the first error.
+type numparser struct {
+	err error
 }
 
-func mustf(s string) float64 {
+func (p *numparser) float(s string) float64 {
 	f, err := strconv.ParseFloat(s, 64)
-	if err != nil {
-		panic(err)
+	if err != nil && p.err == nil {
+		p.err = err
 	}
 	return f
 }
 
-func musti(s string) int {
-	f, err := strconv.ParseInt(s, 10, 64)
-	if err != nil {
-		panic(err)
+func (p *numparser) int(s string) int {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil && p.err == nil {
+		p.err = err
 	}
-	return int(f)
+	return int(i)
 }
 
 func round(x float64) int {
@@ -125,71 +636,48 @@ func round(x float64) int {
 	return int(y)
 }
 
-func geosearch(locs []poploc, query geomys.Point, dist float64) []string {
-	spheroid := geomys.WGS1984()
-	geocen := geomys.NewGeocentric(spheroid)
-	xyz := geocen.Forward(query)
-	xmin, xmax := round(xyz[0]-dist), round(xyz[0]+dist)
-	ymin, ymax := round(xyz[1]-dist), round(xyz[1]+dist)
-	zmin, zmax := round(xyz[2]-dist), round(xyz[2]+dist)
-	//
-	ids := make([]string, 0)
-	for _, loc := range locs {
-		if !(xmin <= loc.x && loc.x <= xmax) {
-			continue
-		}
-		if !(ymin <= loc.y && loc.y <= ymax) {
-			continue
-		}
-		if !(zmin <= loc.z && loc.z <= zmax) {
-			continue
-		}
-		//
-		if geomys.Andoyer(spheroid, query, geomys.Geo(loc.lat, loc.lon)) <= dist {
-			ids = append(ids, loc.id)
-		}
-	}
-	//
-	return ids
+func geosearch(idx *popindex, query geomys.Point, dist float64) []string {
+	return popids(idx.locs, geosearchnear(idx, query, dist))
 }
 
-func popsearch(db *badger.DB, keys []string) ([]string, error) {
-	vals := make([]string, len(keys))
-	//
-	err := db.View(func(txn *badger.Txn) error {
-		for k, key := range keys {
-			item, err := txn.Get([]byte(key))
-			if err != nil {
-				return err
-			}
-			val, err := item.ValueCopy(nil)
-			if err != nil {
-				return err
-			}
-			vals[k] = string(val)
-		}
-		return nil
+// geosearchnear -- returns the blocks within `dist` of `query` in the order of the geo file.
+func geosearchnear(idx *popindex, query geomys.Point, dist float64) []popnear {
+	found := make([]popnear, 0)
+	idx.within(query, dist, func(k int, d float64) {
+		found = append(found, popnear{k, d})
+	})
+	// keep the order of the geo file
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].k < found[j].k
 	})
 	//
-	if err != nil {
-		return nil, err
+	return found
+}
+
+// popids -- returns the block ids of `ns`.
+func popids(locs []poploc, ns []popnear) []string {
+	ids := make([]string, len(ns))
+	for i, n := range ns {
+		ids[i] = locs[n.k].id
 	}
-	//
-	return vals, nil
+	return ids
 }
 
-func popsummary(recs []string) (pop, mpop, fpop int, mpyr, fpyr [24]int) {
+// popsummary -- sums up census records with `n` age buckets.
+// A record is the total population, the male population, `n` male age buckets,
+// the female population and `n` female age buckets.
+func popsummary(recs []string, n int) (pop, mpop, fpop int, mpyr, fpyr []int, err error) {
+	s := newpopsum(n)
+	var p numparser
 	for _, rec := range recs {
-		r := strings.Split(rec, ",")
-		pop += musti(r[0])
-		mpop += musti(r[1])
-		fpop += musti(r[25])
-		for k := range mpyr {
-			mpyr[k] += musti(r[k+1])
-			fpyr[k] += musti(r[k+25])
+		if err := s.add(rec, n, &p); err != nil {
+			return 0, 0, 0, nil, nil, err
 		}
 	}
-	return
+	if p.err != nil {
+		return 0, 0, 0, nil, nil, p.err
+	}
+	return s.pop, s.mpop, s.fpop, s.mpyr, s.fpyr, nil
 }
 
 type pyramid struct {
@@ -218,35 +706,136 @@ type pyramid struct {
 	Age85over int `json:"age_85over"`
 }
 
-func mkpyramid(buf [24]int) pyramid {
+// mkpyramid -- returns the pyramid of the age buckets PopAgesP12.
+func mkpyramid(buf []int) pyramid {
 	var pyr pyramid
-	// ignore buf[0]
-	pyr.Age00to04 = int(buf[1])
-	pyr.Age05to09 = int(buf[2])
-	pyr.Age10to14 = int(buf[3])
-	pyr.Age15to17 = int(buf[4])
-	pyr.Age18to19 = int(buf[5])
-	pyr.Age20 = int(buf[6])
-	pyr.Age21 = int(buf[7])
-	pyr.Age22to24 = int(buf[8])
-	pyr.Age25to29 = int(buf[9])
-	pyr.Age30to34 = int(buf[10])
-	pyr.Age35to39 = int(buf[11])
-	pyr.Age40to44 = int(buf[12])
-	pyr.Age45to49 = int(buf[13])
-	pyr.Age50to54 = int(buf[14])
-	pyr.Age55to59 = int(buf[15])
-	pyr.Age60to61 = int(buf[16])
-	pyr.Age62to64 = int(buf[17])
-	pyr.Age65to66 = int(buf[18])
-	pyr.Age67to69 = int(buf[19])
-	pyr.Age70to74 = int(buf[20])
-	pyr.Age75to79 = int(buf[21])
-	pyr.Age80to84 = int(buf[22])
-	pyr.Age85over = int(buf[23])
+	pyr.Age00to04 = buf[0]
+	pyr.Age05to09 = buf[1]
+	pyr.Age10to14 = buf[2]
+	pyr.Age15to17 = buf[3]
+	pyr.Age18to19 = buf[4]
+	pyr.Age20 = buf[5]
+	pyr.Age21 = buf[6]
+	pyr.Age22to24 = buf[7]
+	pyr.Age25to29 = buf[8]
+	pyr.Age30to34 = buf[9]
+	pyr.Age35to39 = buf[10]
+	pyr.Age40to44 = buf[11]
+	pyr.Age45to49 = buf[12]
+	pyr.Age50to54 = buf[13]
+	pyr.Age55to59 = buf[14]
+	pyr.Age60to61 = buf[15]
+	pyr.Age62to64 = buf[16]
+	pyr.Age65to66 = buf[17]
+	pyr.Age67to69 = buf[18]
+	pyr.Age70to74 = buf[19]
+	pyr.Age75to79 = buf[20]
+	pyr.Age80to84 = buf[21]
+	pyr.Age85over = buf[22]
 	return pyr
 }
 
+// popcount -- the population of a set of census blocks.
+type popcount struct {
+	Blocks   int           `json:"blocks"`
+	Pop2010  int           `json:"pop2010"`
+	Fpop2010 int           `json:"pop2010_female"`
+	Mpop2010 int           `json:"pop2010_male"`
+	Fpyramid *pyramid      `json:"ages_female,omitempty"`
+	Mpyramid *pyramid      `json:"ages_male,omitempty"`
+	Fbands   []popagecount `json:"agebands_female,omitempty"`
+	Mbands   []popagecount `json:"agebands_male,omitempty"`
+}
+
+// popcounts -- reads the records of the blocks `keys` from `store` and sums them up.
+func popcounts(store PopStore, keys []string, opts popageopts) (popcount, error) {
+	counts, err := popcountgroups(store, [][]string{keys}, opts)
+	if err != nil {
+		return popcount{}, err
+	}
+	return counts[0], nil
+}
+
+// popcountgroups -- sums up the records of every group of blocks in `groups`.
+// The records of all groups are read from `store` at once.
+// The population by age is reported as requested by `opts`.
+func popcountgroups(store PopStore, groups [][]string, opts popageopts) ([]popcount, error) {
+	sums, err := popsumgroups(store, groups, len(PopAgesP12))
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]popcount, len(sums))
+	for i, c := range sums {
+		counts[i] = popcount{c.blocks, c.pop, c.fpop, c.mpop, nil, nil, mkagebands(opts.bands, c.fpyr), mkagebands(opts.bands, c.mpyr)}
+		if opts.raw {
+			fpyr, mpyr := mkpyramid(c.fpyr), mkpyramid(c.mpyr)
+			counts[i].Fpyramid, counts[i].Mpyramid = &fpyr, &mpyr
+		}
+	}
+	return counts, nil
+}
+
+// popsum -- the population of a set of census blocks by sex and age bucket.
+type popsum struct {
+	blocks, pop, mpop, fpop int
+	mpyr, fpyr              []int
+}
+
+// newpopsum -- an empty popsum with `n` age buckets.
+func newpopsum(n int) popsum {
+	return popsum{mpyr: make([]int, n), fpyr: make([]int, n)}
+}
+
+// add -- adds the census record `rec` with `n` age buckets to `s`.
+// Number errors are remembered by `p`.
+func (s *popsum) add(rec string, n int, p *numparser) error {
+	r := strings.Split(rec, ",")
+	if len(r) < 2*n+3 {
+		return fmt.Errorf("census record has %d fields, expected %d", len(r), 2*n+3)
+	}
+	s.blocks++
+	s.pop += p.int(r[0])
+	s.mpop += p.int(r[1])
+	s.fpop += p.int(r[n+2])
+	for k := 0; k < n; k++ {
+		s.mpyr[k] += p.int(r[k+2])
+		s.fpyr[k] += p.int(r[k+n+3])
+	}
+	return nil
+}
+
+// popsumgroups -- sums up the records with `n` age buckets of every group of blocks in `groups`.
+// The records of all groups are read from `store` at once, and every record is added
+// to the sum of its group as it is read, so the records are not held in memory.
+func popsumgroups(store PopStore, groups [][]string, n int) ([]popsum, error) {
+	keys := make([]string, 0)
+	for _, g := range groups {
+		keys = append(keys, g...)
+	}
+	sums := make([]popsum, len(groups))
+	for i := range sums {
+		sums[i] = newpopsum(n)
+	}
+	//
+	var p numparser
+	i, end := 0, 0 // the keys of the group `i` end at `end`
+	err := popscan(store, keys, func(k int, rec string) error {
+		for k >= end {
+			end += len(groups[i])
+			i++
+		}
+		return sums[i-1].add(rec, n, &p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	//
+	return sums, nil
+}
+
 func pop2010(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	//
@@ -281,27 +870,34 @@ func pop2010(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	//
-	keys := geosearch(poplocs, geomys.Geo(lat, lon), float64(distance))
-	recs, err := popsearch(popbddb, keys)
+	opts, err := parseageopts(r, PopAgesP12)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	ds, err := pop2010data()
 	if err != nil {
 		HS500(w)
 		return
 	}
+	defer ds.release()
 	//
-	population, mpopulation, fpopulation, mpyr, fpyr := popsummary(recs)
+	ns := geosearchnear(ds.index, geomys.Geo(lat, lon), float64(distance))
+	count, err := popcounts(ds.store, popids(ds.locs, ns), opts)
+	if err != nil {
+		HS500(w)
+		return
+	}
 	//
 	resultx := struct {
 		Duration int64   `json:"duration_ms"`
 		Distance int64   `json:"distance"`
 		Lat      float64 `json:"lat"`
 		Lon      float64 `json:"lon"`
-		Blocks   int     `json:"blocks"`
-		Pop2010  int     `json:"pop2010"`
-		Fpop2010 int     `json:"pop2010_female"`
-		Mpop2010 int     `json:"pop2010_male"`
-		Fpyramid pyramid `json:"ages_female"`
-		Mpyramid pyramid `json:"ages_male"`
-	}{time.Since(start).Milliseconds(), distance, lat, lon, len(recs), population, fpopulation, mpopulation, mkpyramid(fpyr), mkpyramid(mpyr)}
+		popcount
+		popspread
+	}{time.Since(start).Milliseconds(), distance, lat, lon, count, mkpopspread(ds.locs, ns)}
 	//
 	jresult, err := json.Marshal(resultx)
 	if err != nil {
@@ -0,0 +1,761 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetpop2010 -- drops the data of the Pop2010 service, so that the next test loads its own.
+func resetpop2010() {
+	popds.Lock()
+	defer popds.Unlock()
+	if popds.data != nil {
+		popds.data.close()
+	}
+	popds.data = nil
+	popds.reloading = false
+	popds.reloaderr = nil
+}
+
+func TestLoadPopLocsErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		errtext string
+	}{
+		{"fields", "080310327901000,276,39.97,-105.03,-1269032,-4727170\n", "wrong number of fields"},
+		{"pop", "080310327901000,x,39.97,-105.03,-1269032,-4727170,4075794\n", "block 080310327901000"},
+		{"lat", "080310327901000,276,north,-105.03,-1269032,-4727170,4075794\n", "block 080310327901000"},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(dir, tt.name+".txt")
+		if err := os.WriteFile(name, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadpoplocs(name)
+		if err == nil || !strings.Contains(err.Error(), tt.errtext) {
+			t.Errorf("%s: error %v, expected %q", tt.name, err, tt.errtext)
+		}
+	}
+	//
+	if _, err := loadpoplocs(filepath.Join(dir, "missing.txt")); !os.IsNotExist(err) {
+		t.Errorf("missing: error %v", err)
+	}
+	//
+	locs, err := loadpoplocs("testdata/pop2010/nozgeo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locs) != 36 || locs[0].id != "080310327901000" || locs[0].pop != 276 {
+		t.Errorf("testdata: %d blocks, first %+v", len(locs), locs[0])
+	}
+}
+
+func TestPopSummaryErrors(t *testing.T) {
+	rec := "3,2,0,1,0,1,0,1"
+	if _, _, _, _, _, err := popsummary([]string{rec}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, _, err := popsummary([]string{rec}, 3); err == nil {
+		t.Error("short record: no error")
+	}
+	if _, _, _, _, _, err := popsummary([]string{"3,2,0,x,0,1,0,1"}, 2); err == nil {
+		t.Error("bad number: no error")
+	}
+}
+
+func TestPop2010ConfigErrors(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	cfg := Pop2010Config{GeoFile: filepath.Join(t.TempDir(), "missing.txt"), Store: MemPopStore{}}
+	if err := Pop2010(mux.NewRouter(), cfg); !os.IsNotExist(err) {
+		t.Fatalf("Pop2010: error %v", err)
+	}
+	// with Lazy the error is reported by the first request
+	cfg.Lazy = true
+	R := mux.NewRouter()
+	if err := Pop2010(R, cfg); err != nil {
+		t.Fatalf("Pop2010 lazy: error %v", err)
+	}
+	w := httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("GET", "/api/pop2010/1000/lat/39.97/lon/-105.03", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("lazy request: status %d", w.Code)
+	}
+}
+
+// fixturestores -- the records of testdata/pop2010 through CSVPopStore and MemPopStore.
+func fixturestores(t *testing.T) map[string]PopStore {
+	csvstore, err := OpenCSVPopStore("testdata/pop2010/records.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile("testdata/pop2010/records.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memstore := make(MemPopStore)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		comma := strings.IndexByte(line, ',')
+		memstore[line[:comma]] = line[comma+1:]
+	}
+	return map[string]PopStore{"csv": csvstore, "mem": memstore}
+}
+
+func TestPop2010Fixture(t *testing.T) {
+	locs, err := loadpoplocs("testdata/pop2010/nozgeo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spheroid := geomys.WGS1984()
+	query := geomys.Geo(39.97, -105.03)
+	//
+	for name, store := range fixturestores(t) {
+		resetpop2010()
+		R := mux.NewRouter()
+		if err := Pop2010(R, Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: store}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// the blocks around the query, and all the blocks of the fixture
+		for _, distance := range []int{5000, 20000, 1000000} {
+			blocks, pop := 0, 0
+			for _, loc := range locs {
+				if geomys.Andoyer(spheroid, query, geomys.Geo(loc.lat, loc.lon)) <= float64(distance) {
+					blocks++
+					pop += loc.pop
+				}
+			}
+			//
+			w := httptest.NewRecorder()
+			R.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/pop2010/%d/lat/39.97/lon/-105.03", distance), nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s %d: status %d", name, distance, w.Code)
+			}
+			var result popcount
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("%s %d: %v", name, distance, err)
+			}
+			if result.Blocks != blocks || result.Pop2010 != pop || result.Fpop2010+result.Mpop2010 != pop {
+				t.Errorf("%s %d: %+v, expected %d blocks and %d people", name, distance, result, blocks, pop)
+			}
+		}
+		//
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("GET", "/api/pop2010/nearest/3/lat/39.97/lon/-105.03", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s nearest: status %d", name, w.Code)
+		}
+		var nearest struct {
+			Blocks []popblock `json:"blocks"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &nearest); err != nil {
+			t.Fatalf("%s nearest: %v", name, err)
+		}
+		if len(nearest.Blocks) != 3 || nearest.Blocks[0].Id != "080310327901000" || nearest.Blocks[0].Pop2010 != 276 {
+			t.Errorf("%s nearest: %+v", name, nearest.Blocks)
+		}
+	}
+	resetpop2010()
+}
+
+func TestParseEdges(t *testing.T) {
+	tests := []struct {
+		s     string
+		edges []float64
+	}{
+		{"5000,10000", []float64{0, 5000, 10000}},
+		{"0,5000,10000", []float64{0, 5000, 10000}},
+		{"0,1,2,3", []float64{0, 1, 2, 3}},
+		{"1000000", []float64{0, 1000000}},
+		{"0,0,5000", nil},
+		{"5000,0", nil},
+		{"5000,5000", nil},
+		{"10000,5000", nil},
+		{"0", nil},
+		{"-5", nil},
+		{"1000001", nil},
+		{"1,2,x", nil},
+		{"1,2,3,4", nil},
+	}
+	for _, tt := range tests {
+		edges, err := parseedges(tt.s, 3, 1000000)
+		if tt.edges == nil {
+			if err == nil {
+				t.Errorf("%s: %v, expected an error", tt.s, edges)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(edges) != fmt.Sprint(tt.edges) {
+			t.Errorf("%s: %v %v, expected %v", tt.s, edges, err, tt.edges)
+		}
+	}
+}
+
+func TestPop2010Bands(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: fixturestores(t)["mem"]}); err != nil {
+		t.Fatal(err)
+	}
+	locs, err := loadpoplocs("testdata/pop2010/nozgeo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the query is at a block: its distance 0 is on the inner edge of the first band
+	spheroid := geomys.WGS1984()
+	query := geomys.Geo(39.9742359, -105.0270308)
+	edges := []float64{0, 5000, 20000, 40000}
+	blocks, pops := make([]int, 3), make([]int, 3)
+	for _, loc := range locs {
+		d := geomys.Andoyer(spheroid, query, geomys.Geo(loc.lat, loc.lon))
+		for b := 0; b < 3; b++ {
+			if (edges[b] < d || b == 0) && d <= edges[b+1] {
+				blocks[b]++
+				pops[b] += loc.pop
+			}
+		}
+	}
+	//
+	w := httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("GET", "/api/pop2010/bands/0,5000,20000,40000/lat/39.9742359/lon/-105.0270308", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var result struct {
+		Bands []struct {
+			From int64 `json:"from"`
+			To   int64 `json:"to"`
+			popcount
+		} `json:"bands"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Bands) != 3 || result.Bands[0].From != 0 || result.Bands[2].To != 40000 {
+		t.Fatalf("%+v", result.Bands)
+	}
+	sumblocks, sumpop := 0, 0
+	for b, band := range result.Bands {
+		if band.Blocks != blocks[b] || band.Pop2010 != pops[b] {
+			t.Errorf("band %d: %d blocks and %d people, expected %d and %d", b, band.Blocks, band.Pop2010, blocks[b], pops[b])
+		}
+		sumblocks += band.Blocks
+		sumpop += band.Pop2010
+	}
+	// the bands add up to the total within the outer edge
+	w = httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("GET", "/api/pop2010/40000/lat/39.9742359/lon/-105.0270308", nil))
+	var total popcount
+	if err := json.Unmarshal(w.Body.Bytes(), &total); err != nil {
+		t.Fatal(err)
+	}
+	if sumblocks != total.Blocks || sumpop != total.Pop2010 || blocks[0] == 0 {
+		t.Errorf("bands: %d blocks and %d people, total %+v", sumblocks, sumpop, total)
+	}
+}
+
+func TestPop2010Reach(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: MemPopStore{}}); err != nil {
+		t.Fatal(err)
+	}
+	locs, err := loadpoplocs("testdata/pop2010/nozgeo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the blocks sorted by the distance from the query
+	spheroid := geomys.WGS1984()
+	query := geomys.Geo(39.75, -104.99)
+	type block struct {
+		d   float64
+		pop int
+	}
+	sorted := make([]block, len(locs))
+	total := 0
+	for k, loc := range locs {
+		sorted[k] = block{geomys.Andoyer(spheroid, query, geomys.Geo(loc.lat, loc.lon)), loc.pop}
+		total += loc.pop
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].d < sorted[j].d })
+	first3 := sorted[0].pop + sorted[1].pop + sorted[2].pop
+	//
+	w := httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/pop2010/reach/1,%d,%d,%d/lat/39.75/lon/-104.99", first3, first3+1, total+1), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var result struct {
+		Reach []struct {
+			Population int     `json:"population"`
+			Reached    bool    `json:"reached"`
+			Radius     float64 `json:"radius"`
+			Blocks     int     `json:"blocks"`
+			Pop2010    int     `json:"pop2010"`
+		} `json:"reach"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		reached bool
+		blocks  int
+		pop     int
+		radius  float64
+	}{
+		{true, 1, sorted[0].pop, sorted[0].d},
+		// the threshold is reached exactly at the third block
+		{true, 3, first3, sorted[2].d},
+		{true, 4, first3 + sorted[3].pop, sorted[3].d},
+		// not reached: the totals within the search limit
+		{false, len(locs), total, popreachmax},
+	}
+	if len(result.Reach) != len(expected) {
+		t.Fatalf("%+v", result.Reach)
+	}
+	for i, e := range expected {
+		r := result.Reach[i]
+		if r.Reached != e.reached || r.Blocks != e.blocks || r.Pop2010 != e.pop || math.Abs(r.Radius-e.radius) > 1e-3 {
+			t.Errorf("%d: %+v, expected %+v", r.Population, r, e)
+		}
+	}
+}
+
+func TestPop2010Spread(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	// four blocks on the equator: 2 people at 0, 1 person at 1 and -1, nobody at 5
+	geocen := geomys.NewGeocentric(geomys.WGS1984())
+	store := make(MemPopStore)
+	var geo strings.Builder
+	for k, b := range []struct{ lon, pop int }{{0, 2}, {1, 1}, {-1, 1}, {5, 0}} {
+		id := fmt.Sprint("b", k)
+		xyz := geocen.Forward(geomys.Geo(0, float64(b.lon)))
+		fmt.Fprintf(&geo, "%s,%d,0,%d,%d,%d,%d\n", id, b.pop, b.lon, round(xyz[0]), round(xyz[1]), round(xyz[2]))
+		store[id] = fmt.Sprintf("%d,%d,%d%s,0%s", b.pop, b.pop, b.pop, strings.Repeat(",0", 22), strings.Repeat(",0", 23))
+	}
+	geofile := filepath.Join(t.TempDir(), "geo.txt")
+	if err := os.WriteFile(geofile, []byte(geo.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: geofile, Store: store}); err != nil {
+		t.Fatal(err)
+	}
+	//
+	d1 := geomys.Andoyer(geomys.WGS1984(), geomys.Geo(0, 0), geomys.Geo(0, 1))
+	tests := []struct {
+		path            string
+		center          *geolatlon
+		stddist, medist float64
+	}{
+		// the center is the middle block (within the rounding of the geocentric coordinates);
+		// the spread is sqrt((d1²+d1²)/4)
+		{"/api/pop2010/1000000/lat/0/lon/0", &geolatlon{0, 0}, d1 / math.Sqrt2, 0},
+		// a half of the people is within d1 of the block at 1
+		{"/api/pop2010/1000000/lat/0/lon/1", &geolatlon{0, 0}, d1 / math.Sqrt2, d1},
+		// the blocks at 1 and 5
+		{"/api/pop2010/340000/lat/0/lon/4", &geolatlon{0, 1}, 0, 3 * d1},
+		// nobody
+		{"/api/pop2010/1000/lat/0/lon/5", nil, 0, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", tt.path, w.Code)
+		}
+		var result popspread
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if (result.Center == nil) != (tt.center == nil) ||
+			tt.center != nil && (math.Abs(result.Center.Lat-tt.center.Lat) > 1e-5 || math.Abs(result.Center.Lon-tt.center.Lon) > 1e-5) {
+			t.Errorf("%s: center %+v, expected %+v", tt.path, result.Center, tt.center)
+		}
+		if math.Abs(result.StdDistance-tt.stddist) > 1 || math.Abs(result.MedDistance-tt.medist) > 1 {
+			t.Errorf("%s: %+v, expected %.3f and %.3f", tt.path, result, tt.stddist, tt.medist)
+		}
+	}
+}
+
+func TestPop2010Corridor(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: fixturestores(t)["mem"]}); err != nil {
+		t.Fatal(err)
+	}
+	locs, err := loadpoplocs("testdata/pop2010/nozgeo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waypoints := []geolatlon{{39.6, -105.3}, {39.9, -105.0}, {40.0, -104.7}}
+	const buffer = 10000
+	// the distance of every block to every segment, by the segment sampled every 20 meters
+	spheroid := geomys.WGS1984()
+	nav := geonavs[defgeonav]
+	blocks, pops := make([]int, 2), make([]int, 2)
+	for _, loc := range locs {
+		p := geomys.Geo(loc.lat, loc.lon)
+		ds := make([]float64, 2)
+		for i := range ds {
+			seg := newgeseg(nav, geomys.Geo(waypoints[i].Lat, waypoints[i].Lon), geomys.Geo(waypoints[i+1].Lat, waypoints[i+1].Lon))
+			points, _ := seg.sample(int(seg.s12/20) + 2)
+			ds[i] = math.Inf(1)
+			for _, q := range points {
+				ds[i] = math.Min(ds[i], geomys.Andoyer(spheroid, p, q))
+			}
+		}
+		i := 0
+		if ds[1] < ds[0] {
+			i = 1
+		}
+		if math.Abs(ds[i]-buffer) < 50 || math.Abs(ds[0]-ds[1]) < 50 {
+			t.Fatalf("block %s is too close to the edge of the corridor or to both segments", loc.id)
+		}
+		if ds[i] <= buffer {
+			blocks[i]++
+			pops[i] += loc.pop
+		}
+	}
+	//
+	body := `{"buffer":10000,"waypoints":[{"lat":39.6,"lon":-105.3},{"lat":39.9,"lon":-105.0},{"lat":40.0,"lon":-104.7}]}`
+	w := httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("POST", "/api/pop2010/corridor", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var result struct {
+		popcount
+		Segments []popcount `json:"segments"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Segments) != 2 {
+		t.Fatalf("%d segments", len(result.Segments))
+	}
+	// every block is counted once, for the closest segment
+	for i, seg := range result.Segments {
+		if seg.Blocks != blocks[i] || seg.Pop2010 != pops[i] {
+			t.Errorf("segment %d: %d blocks and %d people, expected %d and %d", i, seg.Blocks, seg.Pop2010, blocks[i], pops[i])
+		}
+	}
+	if result.Blocks != blocks[0]+blocks[1] || result.Pop2010 != pops[0]+pops[1] || result.Blocks == 0 {
+		t.Errorf("corridor: %d blocks and %d people, expected %d and %d", result.Blocks, result.Pop2010, blocks[0]+blocks[1], pops[0]+pops[1])
+	}
+	// the body is limited, the same waypoints followed by spaces are too large
+	w = httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("POST", "/api/pop2010/corridor", strings.NewReader(strings.Replace(body, "]}", strings.Repeat(" ", 1<<16)+"]}", 1))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("large body: status %d", w.Code)
+	}
+}
+
+func TestPopSumGroups(t *testing.T) {
+	store := MemPopStore{"a": "3,2,0,1,1,0,1", "b": "2,1,1,0,1,0,1"}
+	groups := [][]string{{}, {"a", "b"}, {}, {"b"}}
+	for _, s := range []PopStore{store, getonlystore{store}} {
+		sums, err := popsumgroups(s, groups, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sums[0].blocks != 0 || sums[1].pop != 5 || sums[1].mpyr[0] != 1 || sums[2].pop != 0 || sums[3].fpop != 1 {
+			t.Errorf("%T: %+v", s, sums)
+		}
+	}
+	if _, err := popsumgroups(store, [][]string{{"a", "c"}}, 2); err == nil {
+		t.Error("missing block: no error")
+	}
+}
+
+func TestPopStoreGet(t *testing.T) {
+	ids := []string{"080310228701001", "080310327901000", "080310228701001"}
+	for name, store := range fixturestores(t) {
+		recs, err := store.Get(ids)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.HasPrefix(recs[0], "240,117,") || !strings.HasPrefix(recs[1], "276,149,") || recs[2] != recs[0] {
+			t.Errorf("%s: %q", name, recs)
+		}
+		if _, err := store.Get([]string{ids[0], "000000000000000"}); err == nil {
+			t.Errorf("%s: missing block: no error", name)
+		}
+		store.Close()
+	}
+}
+
+// getonlystore -- a PopStore that is not a popscanner.
+type getonlystore struct {
+	MemPopStore
+}
+
+func TestPop2010Batch(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: fixturestores(t)["csv"]}); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"sites":[{"id":"a","lat":39.97,"lon":-105.03,"distance":20000},{"id":"b","lat":39.75,"lon":-104.99,"distance":1000000}]}`
+	w := httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("POST", "/api/pop2010/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var result struct {
+		Sites []popcount `json:"sites"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	for k, u := range []string{"/api/pop2010/20000/lat/39.97/lon/-105.03", "/api/pop2010/1000000/lat/39.75/lon/-104.99"} {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("GET", u, nil))
+		var single popcount
+		if err := json.Unmarshal(w.Body.Bytes(), &single); err != nil {
+			t.Fatal(err)
+		}
+		if result.Sites[k].Blocks != single.Blocks || result.Sites[k].Pop2010 != single.Pop2010 {
+			t.Errorf("site %d: %+v, %s: %+v", k, result.Sites[k], u, single)
+		}
+	}
+	// the body is limited, the same sites followed by spaces are too large
+	w = httptest.NewRecorder()
+	R.ServeHTTP(w, httptest.NewRequest("POST", "/api/pop2010/batch", strings.NewReader(strings.Replace(body, "]}", strings.Repeat(" ", 1<<20)+"]}", 1))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("large body: status %d", w.Code)
+	}
+	// the blocks of all sites are limited: the fixture has 36 blocks within 1000000 meters
+	defer func(n int64) { popbatchmax = n }(popbatchmax)
+	popbatchmax = 36
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"sites":[{"id":"a","lat":39.75,"lon":-104.99,"distance":1000000}]}`, http.StatusOK},
+		{`{"sites":[{"id":"a","lat":39.75,"lon":-104.99,"distance":1000000},{"id":"b","lat":39.97,"lon":-105.03,"distance":1}]}`, http.StatusOK},
+		{`{"sites":[{"id":"a","lat":39.75,"lon":-104.99,"distance":1000000},{"id":"b","lat":39.97,"lon":-105.03,"distance":20000}]}`, http.StatusBadRequest},
+	} {
+		w = httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("POST", "/api/pop2010/batch", strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, expected %d", tt.body, w.Code, tt.code)
+		}
+	}
+}
+
+func TestPop2010Polygon(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: fixturestores(t)["mem"]}); err != nil {
+		t.Fatal(err)
+	}
+	locs, err := loadpoplocs("testdata/pop2010/nozgeo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pops := make(map[string]int)
+	for _, loc := range locs {
+		pops[loc.id] = loc.pop
+	}
+	// the box with a hole, counted by hand: the hole takes out 080310808401018 and 080310990401023
+	box := `[[[-105.2,39.6],[-104.9,39.6],[-104.9,39.9],[-105.2,39.9],[-105.2,39.6]],
+		[[-105.17,39.75],[-105.17,39.78],[-105.15,39.78],[-105.15,39.75],[-105.17,39.75]]]`
+	boxids := []string{"080310284501016", "080310322601025", "080310848201021", "080310982501039"}
+	// the eastern box, and a box that overlaps the first one
+	east := `[[[-104.7,39.6],[-104.6,39.6],[-104.6,39.7],[-104.7,39.7],[-104.7,39.6]]]`
+	eastids := []string{"080310676801033", "080310876501032", "080310913801017"}
+	overlap := `[[[-105.1,39.7],[-105.0,39.7],[-105.0,39.75],[-105.1,39.75],[-105.1,39.7]]]`
+	tests := []struct {
+		body string
+		ids  []string
+	}{
+		{`{"type":"Polygon","coordinates":` + box + `}`, boxids},
+		{`{"type":"Feature","properties":{},"geometry":{"type":"Polygon","coordinates":` + box + `}}`, boxids},
+		{`{"type":"MultiPolygon","coordinates":[` + box + `,` + east + `,` + overlap + `]}`, append(append([]string{}, boxids...), eastids...)},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("POST", "/api/pop2010/polygon", strings.NewReader(tt.body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", tt.body, w.Code)
+		}
+		var result popcount
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		pop := 0
+		for _, id := range tt.ids {
+			pop += pops[id]
+		}
+		if result.Blocks != len(tt.ids) || result.Pop2010 != pop {
+			t.Errorf("%s: %+v, expected %d blocks and %d people", tt.body, result, len(tt.ids), pop)
+		}
+	}
+	//
+	many := make([]string, 100001)
+	for k := range many {
+		many[k] = fmt.Sprintf("[%v,39.6]", -105+float64(k)*1e-6)
+	}
+	many[len(many)-1] = many[0]
+	for _, body := range []string{
+		`{"type":"Polygon","coordinates":[[[-105.2,39.6],[-104.9,39.6],[-105.2,39.6]]]}`,
+		`{"type":"LineString","coordinates":[[-105.2,39.6],[-104.9,39.6]]}`,
+		`{"type":"Polygon","coordinates":[[` + strings.Join(many, ",") + `]]}`,
+		`{"type":"Polygon","coordinates":[[[170,50],[-170,50],[-170,55],[170,55],[170,50]]]}`,
+		`{"type":"Polygon","coordinates":[[[-110,30],[-90,30],[-90,45],[-110,45],[-110,30]]]}`,
+	} {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("POST", "/api/pop2010/polygon", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%.80s: status %d", body, w.Code)
+		}
+	}
+}
+
+func TestPop2010GeohashLimit(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: MemPopStore{}}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/api/pop2010/density/geohash/5/lat1/39/lon1/-106/lat2/41/lon2/-104", http.StatusOK},
+		{"/api/pop2010/density/geohash/9/lat1/39.96/lon1/-105.04/lat2/39.99/lon2/-105.01", http.StatusOK},
+		{"/api/pop2010/density/geohash/9/lat1/37/lon1/-109/lat2/41/lon2/-102", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, expected %d", tt.path, w.Code, tt.code)
+		}
+	}
+}
+
+func TestPop2010LoadOnce(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	if err := Pop2010(mux.NewRouter(), Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: MemPopStore{}, Lazy: true}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ds, err := pop2010data()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ds.release()
+		}()
+	}
+	wg.Wait()
+	popds.Lock()
+	defer popds.Unlock()
+	if popds.data == nil || popds.data.generation != popds.generation {
+		t.Fatal("no live data")
+	}
+}
+
+func TestPop2010Reload(t *testing.T) {
+	resetpop2010()
+	defer resetpop2010()
+	geofile := filepath.Join(t.TempDir(), "nozgeo.txt")
+	data, err := os.ReadFile("testdata/pop2010/nozgeo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(geofile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: geofile, Store: MemPopStore{}, AdminReload: true}); err != nil {
+		t.Fatal(err)
+	}
+	type version struct {
+		Generation int     `json:"generation"`
+		GeoFile    string  `json:"geofile"`
+		GeoSum     string  `json:"geofile_sha256"`
+		Blocks     int     `json:"blocks"`
+		Reloading  bool    `json:"reloading"`
+		ReloadErr  *string `json:"reload_error"`
+	}
+	// reload -- reloads the data and returns the version after the reload
+	reload := func() version {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("POST", "/api/pop2010/reload", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("reload: status %d", w.Code)
+		}
+		for {
+			w := httptest.NewRecorder()
+			R.ServeHTTP(w, httptest.NewRequest("GET", "/api/pop2010/version", nil))
+			var v version
+			if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+				t.Fatal(err)
+			}
+			if !v.Reloading {
+				return v
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	popds.Lock()
+	g := popds.generation
+	popds.Unlock()
+	//
+	// the version names the data by the base name and the digest of the geo file, not by its path
+	sum := sha256.Sum256(data)
+	if v := reload(); v.Generation != g+1 || v.Blocks != 36 || v.ReloadErr != nil || v.GeoFile != "nozgeo.txt" || v.GeoSum != hex.EncodeToString(sum[:]) {
+		t.Errorf("reload: %+v", v)
+	}
+	// the first 10 blocks are left
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := os.WriteFile(geofile, []byte(strings.Join(lines[:10], "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum = sha256.Sum256([]byte(strings.Join(lines[:10], "")))
+	if v := reload(); v.Generation != g+2 || v.Blocks != 10 || v.ReloadErr != nil || v.GeoSum != hex.EncodeToString(sum[:]) {
+		t.Errorf("reload: %+v", v)
+	}
+	// a failed reload keeps the live data and does not tell why
+	if err := os.Remove(geofile); err != nil {
+		t.Fatal(err)
+	}
+	v := reload()
+	if v.Generation != g+2 || v.Blocks != 10 || v.ReloadErr == nil || strings.Contains(*v.ReloadErr, geofile) {
+		t.Errorf("failed reload: %+v", v)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseedges -- parses comma-separated increasing band edges in [1,dmax] and prepends 0.
+// An explicit 0 may lead the edges; it is not counted against `nmax`.
+func parseedges(s string, nmax int, dmax int64) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	if fields[0] == "0" {
+		// an explicit inner edge
+		fields = fields[1:]
+	}
+	if len(fields) > nmax {
+		return nil, errors.New("too many band edges")
+	}
+	edges := []float64{0}
+	for _, f := range fields {
+		e, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if !(0 <= e && e <= dmax) {
+			return nil, errors.New("band edge out of range")
+		}
+		if float64(e) <= edges[len(edges)-1] {
+			return nil, errors.New("band edges must increase")
+		}
+		edges = append(edges, float64(e))
+	}
+	if len(edges) < 2 {
+		return nil, errors.New("no band edges")
+	}
+	return edges, nil
+}
+
+func pop2010bands(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	//
+	vars := mux.Vars(r)
+	edges, err := parseedges(vars["edges"], 20, 1000000)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	lat, err := strconv.ParseFloat(vars["lat"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat && lat <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon, err := strconv.ParseFloat(vars["lon"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon && lon <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	opts, err := parseageopts(r, PopAgesP12)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	ds, err := pop2010data()
+	if err != nil {
+		HS500(w)
+		return
+	}
+	defer ds.release()
+	//
+	nb := len(edges) - 1
+	found := make([][]int, nb)
+	ds.index.within(geomys.Geo(lat, lon), edges[nb], func(k int, d float64) {
+		// the band (edges[b],edges[b+1]] that contains d
+		b := sort.SearchFloat64s(edges[1:], d)
+		found[b] = append(found[b], k)
+	})
+	groups := make([][]string, nb)
+	for b, ks := range found {
+		sort.Ints(ks)
+		groups[b] = make([]string, len(ks))
+		for i, k := range ks {
+			groups[b][i] = ds.locs[k].id
+		}
+	}
+	counts, err := popcountgroups(ds.store, groups, opts)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	type band struct {
+		From int64 `json:"from"`
+		To   int64 `json:"to"`
+		popcount
+	}
+	bands := make([]band, nb)
+	for b := range bands {
+		bands[b] = band{int64(edges[b]), int64(edges[b+1]), counts[b]}
+	}
+	//
+	resultx := struct {
+		Duration int64   `json:"duration_ms"`
+		Lat      float64 `json:"lat"`
+		Lon      float64 `json:"lon"`
+		Bands    []band  `json:"bands"`
+	}{time.Since(start).Milliseconds(), lat, lon, bands}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
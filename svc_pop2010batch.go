@@ -0,0 +1,152 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/reconditematter/cds"
+	"github.com/reconditematter/geomys"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// popbatchmax -- the number of blocks that the sites of a batch query may cover together.
+var popbatchmax int64 = 2000000
+
+// popsite -- a site of the batch query.
+type popsite struct {
+	Id       string  `json:"id"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Distance int64   `json:"distance"`
+}
+
+func pop2010batch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const NMAX = 1000
+	//
+	var t struct {
+		Sites []popsite `json:"sites"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&t)
+	if err != nil {
+		// JSON error
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	n := len(t.Sites)
+	if n == 0 || n > NMAX {
+		// array length error
+		HS400t(w, "array length error")
+		return
+	}
+	//
+	setofid := cds.NewSetOfStr()
+	for _, site := range t.Sites {
+		if !(-90 <= site.Lat && site.Lat <= 90 && -180 <= site.Lon && site.Lon <= 180) {
+			HS400t(w, "coordinate error")
+			return
+		}
+		if !(1 <= site.Distance && site.Distance <= 1000000) {
+			HS400t(w, "distance error")
+			return
+		}
+		setofid.Extend(site.Id)
+	}
+	if setofid.Card() != n {
+		// repeated ids error
+		HS400t(w, "repeated ids error")
+		return
+	}
+	//
+	opts, err := parseageopts(r, PopAgesP12)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	ds, err := pop2010data()
+	if err != nil {
+		HS500(w)
+		return
+	}
+	defer ds.release()
+	//
+	groups := make([][]string, n)
+	var blocks int64
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	nworkers := runtime.GOMAXPROCS(0)
+	if nworkers > n {
+		nworkers = n
+	}
+	wg.Add(nworkers)
+	for i := 0; i < nworkers; i++ {
+		go func() {
+			for k := range jobs {
+				if atomic.LoadInt64(&blocks) > popbatchmax {
+					continue
+				}
+				site := t.Sites[k]
+				query := geomys.Geo(site.Lat, site.Lon)
+				// count the blocks of the site before keeping them, so that at most popbatchmax are kept
+				count := 0
+				ds.index.within(query, float64(site.Distance), func(int, float64) { count++ })
+				if atomic.AddInt64(&blocks, int64(count)) > popbatchmax {
+					continue
+				}
+				groups[k] = geosearch(ds.index, query, float64(site.Distance))
+			}
+			wg.Done()
+		}()
+	}
+	for k := range t.Sites {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+	if blocks > popbatchmax {
+		HS400t(w, "too many blocks")
+		return
+	}
+	// the records of all sites are read at once
+	counts, err := popcountgroups(ds.store, groups, opts)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	type siteresult struct {
+		Id       string  `json:"id"`
+		Distance int64   `json:"distance"`
+		Lat      float64 `json:"lat"`
+		Lon      float64 `json:"lon"`
+		popcount
+	}
+	result := make([]siteresult, n)
+	for k, site := range t.Sites {
+		result[k] = siteresult{site.Id, site.Distance, site.Lat, site.Lon, counts[k]}
+	}
+	//
+	resultx := struct {
+		Duration int64        `json:"duration_ms"`
+		Count    int          `json:"count"`
+		Sites    []siteresult `json:"sites"`
+	}{time.Since(start).Milliseconds(), n, result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
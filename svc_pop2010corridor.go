@@ -0,0 +1,167 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// segnear -- a block near a segment: the closest sample of the segment and the distance to it.
+type segnear struct {
+	sample int
+	d      float64
+}
+
+func pop2010corridor(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const NMAX = 100
+	const SMAX = 100000
+	//
+	var t struct {
+		Buffer    int64       `json:"buffer"`
+		Waypoints []geolatlon `json:"waypoints"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&t)
+	if err != nil {
+		// JSON error
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	if !(1 <= t.Buffer && t.Buffer <= 100000) {
+		HS400t(w, "buffer error")
+		return
+	}
+	n := len(t.Waypoints)
+	if n < 2 || n > NMAX {
+		// array length error
+		HS400t(w, "array length error")
+		return
+	}
+	for _, p := range t.Waypoints {
+		if !(-90 <= p.Lat && p.Lat <= 90 && -180 <= p.Lon && p.Lon <= 180) {
+			HS400t(w, "coordinate error")
+			return
+		}
+	}
+	//
+	opts, err := parseageopts(r, PopAgesP12)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	ds, err := pop2010data()
+	if err != nil {
+		HS500(w)
+		return
+	}
+	defer ds.release()
+	//
+	segs := make([]geseg, n-1)
+	length := 0.0
+	for i := range segs {
+		p1, p2 := t.Waypoints[i], t.Waypoints[i+1]
+		segs[i] = newgeseg(geonavs[defgeonav], geomys.Geo(p1.Lat, p1.Lon), geomys.Geo(p2.Lat, p2.Lon))
+		length += segs[i].s12
+	}
+	// The segments are sampled every `h` meters. A block within the buffer
+	// of a segment is within buffer+h/2 of one of its samples.
+	buffer := float64(t.Buffer)
+	h := math.Max(math.Max(buffer, 1000), length/SMAX)
+	radius := buffer + h/2
+	//
+	spheroid := geomys.WGS1984()
+	best := make(map[int]int) // block -> segment
+	bestd := make(map[int]float64)
+	for i := range segs {
+		seg := &segs[i]
+		count := int(math.Ceil(seg.s12/h)) + 1
+		if count < 2 {
+			count = 2
+		}
+		step := seg.s12 / float64(count-1)
+		points, _ := seg.sample(count)
+		near := make(map[int]segnear)
+		for j, p := range points {
+			ds.index.within(p, radius, func(k int, d float64) {
+				if sn, ok := near[k]; !ok || d < sn.d {
+					near[k] = segnear{j, d}
+				}
+			})
+		}
+		// the distance to the segment is minimized around the closest sample
+		for k, sn := range near {
+			loc := geomys.Geo(ds.locs[k].lat, ds.locs[k].lon)
+			a := math.Max(0, float64(sn.sample-1)*step)
+			b := math.Min(seg.s12, float64(sn.sample+1)*step)
+			_, d := goldenmin(func(s float64) float64 {
+				p, _ := seg.at(s)
+				return geomys.Andoyer(spheroid, p, loc)
+			}, a, b, 0.01)
+			if d > buffer {
+				continue
+			}
+			if bd, ok := bestd[k]; !ok || d < bd {
+				best[k], bestd[k] = i, d
+			}
+		}
+	}
+	//
+	found := make([][]int, len(segs))
+	all := make([]int, 0, len(best))
+	for k, i := range best {
+		found[i] = append(found[i], k)
+		all = append(all, k)
+	}
+	groups := make([][]string, len(segs)+1)
+	for i, ks := range append(found, all) {
+		sort.Ints(ks)
+		groups[i] = make([]string, len(ks))
+		for j, k := range ks {
+			groups[i][j] = ds.locs[k].id
+		}
+	}
+	counts, err := popcountgroups(ds.store, groups, opts)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	type segment struct {
+		From   geolatlon `json:"from"`
+		To     geolatlon `json:"to"`
+		Length float64   `json:"length"`
+		popcount
+	}
+	result := make([]segment, len(segs))
+	for i, seg := range segs {
+		result[i] = segment{t.Waypoints[i], t.Waypoints[i+1], math.Round(seg.s12*1e3) / 1e3, counts[i]}
+	}
+	//
+	resultx := struct {
+		Duration  int64   `json:"duration_ms"`
+		Buffer    int64   `json:"buffer"`
+		Length    float64 `json:"length"`
+		Waypoints int     `json:"waypoints"`
+		popcount
+		Segments []segment `json:"segments"`
+	}{time.Since(start).Milliseconds(), t.Buffer, math.Round(length*1e3) / 1e3, n, counts[len(segs)], result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
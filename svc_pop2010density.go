@@ -0,0 +1,289 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// parsebbox -- parses and checks the bounding box {lat1},{lon1} (south-west) - {lat2},{lon2} (north-east).
+func parsebbox(vars map[string]string) (lat1, lon1, lat2, lon2 float64, ok bool) {
+	var err error
+	lat1, err = strconv.ParseFloat(vars["lat1"], 64)
+	if err != nil {
+		return
+	}
+	lon1, err = strconv.ParseFloat(vars["lon1"], 64)
+	if err != nil {
+		return
+	}
+	lat2, err = strconv.ParseFloat(vars["lat2"], 64)
+	if err != nil {
+		return
+	}
+	lon2, err = strconv.ParseFloat(vars["lon2"], 64)
+	if err != nil {
+		return
+	}
+	if !(-90 <= lat1 && lat1 < lat2 && lat2 <= 90) {
+		return
+	}
+	if !(-180 <= lon1 && lon1 < lon2 && lon2 <= 180) {
+		return
+	}
+	ok = true
+	return
+}
+
+func pop2010gridjson(w http.ResponseWriter, r *http.Request) {
+	pop2010grid(w, r, "")
+}
+
+func pop2010gridgray(w http.ResponseWriter, r *http.Request) {
+	pop2010grid(w, r, "gray")
+}
+
+func pop2010gridheat(w http.ResponseWriter, r *http.Request) {
+	pop2010grid(w, r, "heat")
+}
+
+func pop2010grid(w http.ResponseWriter, r *http.Request, colormap string) {
+	start := time.Now()
+	const NMAX = 1000000
+	vars := mux.Vars(r)
+	//
+	step, err := strconv.ParseFloat(vars["step"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(0.001 <= step && step <= 10) {
+		HS400(w)
+		return
+	}
+	//
+	lat1, lon1, lat2, lon2, ok := parsebbox(vars)
+	if !ok {
+		HS400(w)
+		return
+	}
+	rows := int(math.Ceil((lat2 - lat1) / step))
+	cols := int(math.Ceil((lon2 - lon1) / step))
+	if rows*cols > NMAX {
+		HS400t(w, "too many cells")
+		return
+	}
+	//
+	ds, err := pop2010data()
+	if err != nil {
+		HS500(w)
+		return
+	}
+	defer ds.release()
+	//
+	grid := make([][]int, rows)
+	for i := range grid {
+		grid[i] = make([]int, cols)
+	}
+	blocks, total, pmax := 0, 0, 0
+	for _, loc := range ds.locs {
+		if !(lat1 <= loc.lat && loc.lat <= lat2 && lon1 <= loc.lon && loc.lon <= lon2) {
+			continue
+		}
+		i := int((loc.lat - lat1) / step)
+		j := int((loc.lon - lon1) / step)
+		if i == rows {
+			i--
+		}
+		if j == cols {
+			j--
+		}
+		grid[i][j] += loc.pop
+		if grid[i][j] > pmax {
+			pmax = grid[i][j]
+		}
+		blocks++
+		total += loc.pop
+	}
+	//
+	if colormap != "" {
+		b, err := densitypng(grid, pmax, colormap)
+		if err != nil {
+			HS500(w)
+			return
+		}
+		HS200png(w, b)
+		return
+	}
+	//
+	resultx := struct {
+		Duration int64     `json:"duration_ms"`
+		Min      geolatlon `json:"min"`
+		Max      geolatlon `json:"max"`
+		Step     float64   `json:"step"`
+		Rows     int       `json:"rows"`
+		Cols     int       `json:"cols"`
+		Blocks   int       `json:"blocks"`
+		Pop2010  int       `json:"pop2010"`
+		PopMax   int       `json:"pop2010_max"`
+		Grid     [][]int   `json:"grid"`
+	}{time.Since(start).Milliseconds(), geolatlon{lat1, lon1}, geolatlon{lat2, lon2}, step, rows, cols, blocks, total, pmax, grid}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+// densitypng -- renders `grid` (south to north) as a PNG image (north up) on a logarithmic scale.
+func densitypng(grid [][]int, pmax int, colormap string) ([]byte, error) {
+	rows := len(grid)
+	cols := 0
+	if rows > 0 {
+		cols = len(grid[0])
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, cols, rows))
+	lmax := math.Log1p(float64(pmax))
+	for i, row := range grid {
+		for j, p := range row {
+			if p == 0 {
+				// transparent
+				continue
+			}
+			t := math.Log1p(float64(p)) / lmax
+			var c color.NRGBA
+			if colormap == "heat" {
+				c = heatcolor(t)
+			} else {
+				g := uint8(math.Round(255 * t))
+				c = color.NRGBA{g, g, g, 255}
+			}
+			img.SetNRGBA(j, rows-1-i, c)
+		}
+	}
+	//
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// heatcolor -- maps `t` in [0,1] to black-red-yellow-white.
+func heatcolor(t float64) color.NRGBA {
+	v := math.Max(0, math.Min(1, t)) * 3
+	r := math.Min(1, v)
+	g := math.Max(0, math.Min(1, v-1))
+	b := math.Max(0, math.Min(1, v-2))
+	return color.NRGBA{uint8(math.Round(255 * r)), uint8(math.Round(255 * g)), uint8(math.Round(255 * b)), 255}
+}
+
+func pop2010geohash(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const NMAX = 1000000
+	vars := mux.Vars(r)
+	//
+	length, err := strconv.ParseInt(vars["length"], 10, 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(length == 3 || length == 5 || length == 7 || length == 9) {
+		HS400(w)
+		return
+	}
+	//
+	lat1, lon1, lat2, lon2, ok := parsebbox(vars)
+	if !ok {
+		HS400(w)
+		return
+	}
+	// a geohash of odd length is a square cell of 360/2^((5*length+1)/2) degrees,
+	// and the bounding box meets at most one more row and column than it covers
+	size := 360 / math.Exp2(float64((5*length+1)/2))
+	rows := int(math.Ceil((lat2-lat1)/size)) + 1
+	cols := int(math.Ceil((lon2-lon1)/size)) + 1
+	if rows*cols > NMAX {
+		HS400t(w, "too many cells")
+		return
+	}
+	//
+	ds, err := pop2010data()
+	if err != nil {
+		HS500(w)
+		return
+	}
+	defer ds.release()
+	//
+	type cell struct {
+		Geohash string  `json:"geohash"`
+		Lat     float64 `json:"lat"`
+		Lon     float64 `json:"lon"`
+		Blocks  int     `json:"blocks"`
+		Pop2010 int     `json:"pop2010"`
+	}
+	cells := make(map[string]*cell)
+	blocks, total := 0, 0
+	_, resd := geomys.GeoHash(int(length), geomys.Geo(lat1, lon1))
+	for _, loc := range ds.locs {
+		if !(lat1 <= loc.lat && loc.lat <= lat2 && lon1 <= loc.lon && loc.lon <= lon2) {
+			continue
+		}
+		hash, _ := geomys.GeoHash(int(length), geomys.Geo(loc.lat, loc.lon))
+		c, ok := cells[hash]
+		if !ok {
+			c = &cell{Geohash: hash}
+			if p, ok := geomys.HashGeo(hash); ok {
+				c.Lat, c.Lon = p.Geo()
+			}
+			cells[hash] = c
+		}
+		c.Blocks++
+		c.Pop2010 += loc.pop
+		blocks++
+		total += loc.pop
+	}
+	result := make([]cell, 0, len(cells))
+	for _, c := range cells {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Geohash < result[j].Geohash
+	})
+	//
+	resultx := struct {
+		Duration int64     `json:"duration_ms"`
+		Min      geolatlon `json:"min"`
+		Max      geolatlon `json:"max"`
+		Length   int64     `json:"length"`
+		Resd     float64   `json:"res_d"`
+		Blocks   int       `json:"blocks"`
+		Pop2010  int       `json:"pop2010"`
+		Count    int       `json:"count"`
+		Cells    []cell    `json:"cells"`
+	}{time.Since(start).Milliseconds(), geolatlon{lat1, lon1}, geolatlon{lat2, lon2}, length, resd, blocks, total, len(result), result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// popblock -- a census block with its own population.
+type popblock struct {
+	Id       string        `json:"id"`
+	Lat      float64       `json:"lat"`
+	Lon      float64       `json:"lon"`
+	Distance float64       `json:"distance"`
+	Pop2010  int           `json:"pop2010"`
+	Fpop2010 int           `json:"pop2010_female"`
+	Mpop2010 int           `json:"pop2010_male"`
+	Fpyramid *pyramid      `json:"ages_female,omitempty"`
+	Mpyramid *pyramid      `json:"ages_male,omitempty"`
+	Fbands   []popagecount `json:"agebands_female,omitempty"`
+	Mbands   []popagecount `json:"agebands_male,omitempty"`
+}
+
+func pop2010nearestjson(w http.ResponseWriter, r *http.Request) {
+	pop2010nearest(w, r, false)
+}
+
+func pop2010nearestgeojson(w http.ResponseWriter, r *http.Request) {
+	pop2010nearest(w, r, true)
+}
+
+func pop2010nearest(w http.ResponseWriter, r *http.Request, geojson bool) {
+	start := time.Now()
+	vars := mux.Vars(r)
+	//
+	count, err := strconv.ParseInt(vars["count"], 10, 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(1 <= count && count <= 1000) {
+		HS400(w)
+		return
+	}
+	//
+	lat, err := strconv.ParseFloat(vars["lat"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat && lat <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon, err := strconv.ParseFloat(vars["lon"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon && lon <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	opts, err := parseageopts(r, PopAgesP12)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	ds, err := pop2010data()
+	if err != nil {
+		HS500(w)
+		return
+	}
+	defer ds.release()
+	//
+	ns := ds.index.nearest(geomys.Geo(lat, lon), popreachmax, func(ns []popnear) bool {
+		return len(ns) >= int(count)
+	})
+	if len(ns) > int(count) {
+		ns = ns[:count]
+	}
+	// one group per block
+	groups := make([][]string, len(ns))
+	for i, n := range ns {
+		groups[i] = []string{ds.locs[n.k].id}
+	}
+	counts, err := popcountgroups(ds.store, groups, opts)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	blocks := make([]popblock, len(ns))
+	for i, n := range ns {
+		loc, c := &ds.locs[n.k], &counts[i]
+		blocks[i] = popblock{loc.id, loc.lat, loc.lon, math.Round(n.d*1e3) / 1e3, c.Pop2010, c.Fpop2010, c.Mpop2010, c.Fpyramid, c.Mpyramid, c.Fbands, c.Mbands}
+	}
+	//
+	if geojson {
+		type point struct {
+			Type        string     `json:"type"`
+			Coordinates [2]float64 `json:"coordinates"`
+		}
+		type feature struct {
+			Type       string   `json:"type"`
+			Geometry   point    `json:"geometry"`
+			Properties popblock `json:"properties"`
+		}
+		features := make([]feature, len(blocks))
+		for i, b := range blocks {
+			features[i] = feature{"Feature", point{"Point", [2]float64{b.Lon, b.Lat}}, b}
+		}
+		resultx := struct {
+			Type     string    `json:"type"`
+			Features []feature `json:"features"`
+		}{"FeatureCollection", features}
+		//
+		jresult, err := json.Marshal(resultx)
+		if err != nil {
+			HS500(w)
+			return
+		}
+		//
+		HS200geojson(w, jresult)
+		return
+	}
+	//
+	resultx := struct {
+		Duration int64      `json:"duration_ms"`
+		Lat      float64    `json:"lat"`
+		Lon      float64    `json:"lon"`
+		Count    int        `json:"count"`
+		Blocks   []popblock `json:"blocks"`
+	}{time.Since(start).Milliseconds(), lat, lon, len(blocks), blocks}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// geopolygon -- a polygon in geographic coordinates.
+// The vertices are [lon,lat] pairs, the first ring is the boundary, other rings are holes.
+type geopolygon struct {
+	rings    [][][2]float64
+	min, max [2]float64
+}
+
+func newgeopolygon(coords [][][]float64) (geopolygon, error) {
+	var pg geopolygon
+	if len(coords) == 0 {
+		return pg, errors.New("polygon without rings")
+	}
+	for _, c := range coords {
+		if len(c) < 4 {
+			return pg, errors.New("polygon ring with less than 4 positions")
+		}
+		ring := make([][2]float64, len(c))
+		for k, pos := range c {
+			if len(pos) < 2 {
+				return pg, errors.New("position with less than 2 coordinates")
+			}
+			lon, lat := pos[0], pos[1]
+			if !(-90 <= lat && lat <= 90 && -180 <= lon && lon <= 180) {
+				return pg, errors.New("coordinate error")
+			}
+			ring[k] = [2]float64{lon, lat}
+			if k > 0 && math.Abs(lon-ring[k-1][0]) > 180 {
+				return pg, errors.New("polygon crosses the antimeridian, it must be split there (RFC 7946, 3.1.9)")
+			}
+		}
+		pg.rings = append(pg.rings, ring)
+	}
+	//
+	pg.min, pg.max = pg.rings[0][0], pg.rings[0][0]
+	for _, v := range pg.rings[0] {
+		for i := 0; i < 2; i++ {
+			if v[i] < pg.min[i] {
+				pg.min[i] = v[i]
+			}
+			if v[i] > pg.max[i] {
+				pg.max[i] = v[i]
+			}
+		}
+	}
+	return pg, nil
+}
+
+// bcap -- returns a cap around the bounding box of the polygon: the center of the box
+// and the largest distance from it to the sides of the box, and the distance between
+// the points sampled on the sides, by which the largest distance may be underestimated.
+func (pg *geopolygon) bcap() (center geomys.Point, radius, spacing float64) {
+	const N = 64
+	spheroid := geomys.WGS1984()
+	center = geomys.Geo((pg.min[1]+pg.max[1])/2, (pg.min[0]+pg.max[0])/2)
+	corners := [5][2]float64{pg.min, {pg.max[0], pg.min[1]}, pg.max, {pg.min[0], pg.max[1]}, pg.min}
+	for i := 0; i < 4; i++ {
+		a, b := corners[i], corners[i+1]
+		prev := geomys.Geo(a[1], a[0])
+		for k := 0; k <= N; k++ {
+			f := float64(k) / N
+			p := geomys.Geo(a[1]+f*(b[1]-a[1]), a[0]+f*(b[0]-a[0]))
+			radius = math.Max(radius, geomys.Andoyer(spheroid, center, p))
+			spacing = math.Max(spacing, geomys.Andoyer(spheroid, prev, p))
+			prev = p
+		}
+	}
+	return
+}
+
+// inbox -- reports whether the location `lat`,`lon` is inside the bounding box of the polygon.
+func (pg *geopolygon) inbox(lat, lon float64) bool {
+	return pg.min[0] <= lon && lon <= pg.max[0] && pg.min[1] <= lat && lat <= pg.max[1]
+}
+
+// contains -- reports whether the location `lat`,`lon` is inside the polygon.
+func (pg *geopolygon) contains(lat, lon float64) bool {
+	if !pg.inbox(lat, lon) {
+		return false
+	}
+	if !inring(pg.rings[0], lon, lat) {
+		return false
+	}
+	for _, hole := range pg.rings[1:] {
+		if inring(hole, lon, lat) {
+			return false
+		}
+	}
+	return true
+}
+
+// inring -- the even-odd (ray casting) point-in-polygon test in the lon/lat plane.
+// The ring is treated as closed whether or not its last vertex repeats the first one.
+func inring(ring [][2]float64, x, y float64) bool {
+	in := false
+	n := len(ring)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
+
+// parsepolygons -- parses a GeoJSON Polygon or MultiPolygon geometry,
+// or a Feature with such a geometry.
+func parsepolygons(data []byte) (typ string, pgs []geopolygon, err error) {
+	var obj struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+		Geometry    json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return "", nil, err
+	}
+	//
+	switch obj.Type {
+	case "Feature":
+		if len(obj.Geometry) == 0 || string(obj.Geometry) == "null" {
+			return "", nil, errors.New("feature without geometry")
+		}
+		return parsepolygons(obj.Geometry)
+	case "Polygon":
+		var coords [][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return "", nil, err
+		}
+		pg, err := newgeopolygon(coords)
+		if err != nil {
+			return "", nil, err
+		}
+		return obj.Type, []geopolygon{pg}, nil
+	case "MultiPolygon":
+		var coords [][][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return "", nil, err
+		}
+		if len(coords) == 0 {
+			return "", nil, errors.New("empty multipolygon")
+		}
+		for _, c := range coords {
+			pg, err := newgeopolygon(c)
+			if err != nil {
+				return "", nil, err
+			}
+			pgs = append(pgs, pg)
+		}
+		return obj.Type, pgs, nil
+	}
+	//
+	return "", nil, errors.New("geometry type must be Polygon or MultiPolygon")
+}
+
+func pop2010polygon(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const NMAX = 100000
+	const DMAX = 1000000   // the radius of the cap around a polygon
+	const TMAX = 200000000 // the point-in-ring edge tests
+	//
+	var data json.RawMessage
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20))
+	if err := decoder.Decode(&data); err != nil {
+		// JSON error
+		HS400t(w, err.Error())
+		return
+	}
+	typ, pgs, err := parsepolygons(data)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	vertices := 0
+	for _, pg := range pgs {
+		for _, ring := range pg.rings {
+			vertices += len(ring)
+		}
+	}
+	if vertices > NMAX {
+		HS400t(w, "too many vertices")
+		return
+	}
+	//
+	opts, err := parseageopts(r, PopAgesP12)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	ds, err := pop2010data()
+	if err != nil {
+		HS500(w)
+		return
+	}
+	defer ds.release()
+	//
+	// the candidates are the blocks of the index within a cap around every polygon
+	tests := 0
+	cands := make([][]popnear, len(pgs))
+	for i := range pgs {
+		center, radius, spacing := pgs[i].bcap()
+		if radius > DMAX {
+			HS400t(w, "polygon too large")
+			return
+		}
+		cands[i] = geosearchnear(ds.index, center, radius+spacing)
+		n := 0
+		for _, c := range cands[i] {
+			if loc := &ds.locs[c.k]; pgs[i].inbox(loc.lat, loc.lon) {
+				n++
+			}
+		}
+		for _, ring := range pgs[i].rings {
+			tests += n * len(ring)
+		}
+		if tests > TMAX {
+			HS400t(w, "too many blocks for the number of vertices")
+			return
+		}
+	}
+	inside := make(map[int]bool)
+	for i := range pgs {
+		for _, c := range cands[i] {
+			if loc := &ds.locs[c.k]; !inside[c.k] && pgs[i].contains(loc.lat, loc.lon) {
+				inside[c.k] = true
+			}
+		}
+	}
+	ns := make([]popnear, 0, len(inside))
+	for k := range inside {
+		ns = append(ns, popnear{k, 0})
+	}
+	// keep the order of the geo file
+	sort.Slice(ns, func(i, j int) bool {
+		return ns[i].k < ns[j].k
+	})
+	count, err := popcounts(ds.store, popids(ds.locs, ns), opts)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	resultx := struct {
+		Duration int64  `json:"duration_ms"`
+		Type     string `json:"type"`
+		Polygons int    `json:"polygons"`
+		Vertices int    `json:"vertices"`
+		popcount
+	}{time.Since(start).Milliseconds(), typ, len(pgs), vertices, count}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// popreachmax -- the largest search radius of the reach query in meters.
+const popreachmax = 2000000
+
+func pop2010reach(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const NMAX = 20
+	//
+	vars := mux.Vars(r)
+	fields := strings.Split(vars["thresholds"], ",")
+	if len(fields) > NMAX {
+		HS400t(w, "too many thresholds")
+		return
+	}
+	thresholds := make([]int, len(fields))
+	tmax := 0
+	for i, f := range fields {
+		t, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		if !(1 <= t && t <= 100000000) {
+			HS400(w)
+			return
+		}
+		thresholds[i] = int(t)
+		if thresholds[i] > tmax {
+			tmax = thresholds[i]
+		}
+	}
+	//
+	lat, err := strconv.ParseFloat(vars["lat"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat && lat <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon, err := strconv.ParseFloat(vars["lon"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon && lon <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	ds, err := pop2010data()
+	if err != nil {
+		HS500(w)
+		return
+	}
+	defer ds.release()
+	//
+	ns := ds.index.nearest(geomys.Geo(lat, lon), popreachmax, func(ns []popnear) bool {
+		pop := 0
+		for _, n := range ns {
+			pop += ds.locs[n.k].pop
+		}
+		return pop >= tmax
+	})
+	//
+	type reach struct {
+		Population int     `json:"population"`
+		Reached    bool    `json:"reached"`
+		Radius     float64 `json:"radius"`
+		Blocks     int     `json:"blocks"`
+		Pop2010    int     `json:"pop2010"`
+	}
+	result := make([]reach, len(thresholds))
+	for i, t := range thresholds {
+		// the search limit unless the threshold is crossed
+		result[i] = reach{t, false, popreachmax, len(ns), 0}
+		pop := 0
+		for j, n := range ns {
+			pop += ds.locs[n.k].pop
+			if pop >= t {
+				result[i] = reach{t, true, math.Round(n.d*1e3) / 1e3, j + 1, pop}
+				break
+			}
+		}
+		if !result[i].Reached {
+			result[i].Pop2010 = pop
+		}
+	}
+	//
+	resultx := struct {
+		Duration int64   `json:"duration_ms"`
+		Lat      float64 `json:"lat"`
+		Lon      float64 `json:"lon"`
+		Reach    []reach `json:"reach"`
+	}{time.Since(start).Milliseconds(), lat, lon, result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// errreloading -- a reload is requested while another one is in progress.
+var errreloading = errors.New("reload in progress")
+
+// Pop2010Reload -- loads the data of the Pop2010 service again from the configured locations
+// and makes them live. Requests in progress finish with the data they started with.
+// The live data are not changed if the loading fails.
+func Pop2010Reload() error {
+	v, err := popds.beginreload()
+	if err != nil {
+		return err
+	}
+	return popds.endreload(v)
+}
+
+// beginreload -- marks a reload as in progress and returns the current vintage configuration.
+func (src *popsource) beginreload() (PopVintage, error) {
+	src.Lock()
+	defer src.Unlock()
+	if src.reloading {
+		return PopVintage{}, errreloading
+	}
+	src.reloading = true
+	return src.vintage, nil
+}
+
+// endreload -- loads the data of `v` and swaps them for the live data.
+func (src *popsource) endreload(v PopVintage) error {
+	ds, err := loadpopdataset(v)
+	//
+	src.Lock()
+	defer src.Unlock()
+	src.reloading = false
+	src.reloaderr = err
+	if err != nil {
+		return err
+	}
+	src.publish(ds)
+	return nil
+}
+
+// pop2010sighup -- reloads the data on every SIGHUP.
+func pop2010sighup() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := Pop2010Reload(); err != nil {
+				log.Printf("pop2010: reload: %v", err)
+				continue
+			}
+			log.Printf("pop2010: reloaded")
+		}
+	}()
+}
+
+func pop2010reload(w http.ResponseWriter, r *http.Request) {
+	v, err := popds.beginreload()
+	if err != nil {
+		HS409t(w, err.Error())
+		return
+	}
+	popds.Lock()
+	generation := popds.generation
+	popds.Unlock()
+	go func() {
+		if err := popds.endreload(v); err != nil {
+			log.Printf("pop2010: reload: %v", err)
+		}
+	}()
+	//
+	resultx := struct {
+		Reloading  bool `json:"reloading"`
+		Generation int  `json:"generation"`
+	}{true, generation}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+func pop2010version(w http.ResponseWriter, r *http.Request) {
+	type version struct {
+		Generation int        `json:"generation"`
+		Loaded     *time.Time `json:"loaded"`
+		GeoFile    string     `json:"geofile"`
+		GeoSum     string     `json:"geofile_sha256"`
+		GeoMod     *time.Time `json:"geofile_modified"`
+		Blocks     int        `json:"blocks"`
+		Reloading  bool       `json:"reloading"`
+		ReloadErr  *string    `json:"reload_error"`
+	}
+	var resultx version
+	popds.Lock()
+	if ds := popds.data; ds != nil {
+		loaded, geomod := ds.loaded, ds.geomod
+		resultx.Generation = ds.generation
+		resultx.Loaded = &loaded
+		resultx.GeoFile = ds.geofile
+		resultx.GeoSum = ds.geosum
+		resultx.GeoMod = &geomod
+		resultx.Blocks = len(ds.locs)
+	}
+	resultx.Reloading = popds.reloading
+	if popds.reloaderr != nil {
+		// the details are in the server log
+		errmsg := "the data could not be loaded"
+		resultx.ReloadErr = &errmsg
+	}
+	popds.Unlock()
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// resetpop -- drops the vintages of the Pop service and the data of the Pop2010 service.
+func resetpop() {
+	resetpop2010()
+	popsources.Lock()
+	defer popsources.Unlock()
+	for year, src := range popsources.m {
+		if src != &popds && src.data != nil {
+			src.data.close()
+		}
+		delete(popsources.m, year)
+	}
+}
+
+// popfixture -- the records of testdata/pop2010 with the P12 age buckets merged as `groups`
+// (the ranges of bucket indexes), and every count multiplied by `scale`.
+func popfixture(t *testing.T, groups [][2]int, scale int) MemPopStore {
+	n := len(PopAgesP12)
+	store := make(MemPopStore)
+	for id, rec := range fixturestores(t)["mem"].(MemPopStore) {
+		r := strings.Split(rec, ",")
+		out := []string{}
+		add := func(count int) {
+			out = append(out, strconv.Itoa(scale*count))
+		}
+		field := func(k int) int {
+			v, err := strconv.Atoi(r[k])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+		// the total, then each sex with its total and its age buckets
+		add(field(0))
+		for _, base := range []int{1, n + 2} {
+			add(field(base))
+			for _, g := range groups {
+				sum := 0
+				for k := g[0]; k <= g[1]; k++ {
+					sum += field(base + 1 + k)
+				}
+				add(sum)
+			}
+		}
+		store[id] = strings.Join(out, ",")
+	}
+	return store
+}
+
+func TestPopVintages(t *testing.T) {
+	resetpop()
+	defer resetpop()
+	// 2000 has three age buckets, 2020 has the P12 age buckets and twice the people of 2010
+	coarse := []PopAgeBucket{{0, 17}, {18, 64}, {65, -1}}
+	p12 := make([][2]int, len(PopAgesP12))
+	for k := range p12 {
+		p12[k] = [2]int{k, k}
+	}
+	R := mux.NewRouter()
+	if err := Pop2010(R, Pop2010Config{GeoFile: "testdata/pop2010/nozgeo.txt", Store: fixturestores(t)["mem"]}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := PopConfig{Vintages: []PopVintage{
+		{Year: 2000, GeoFile: "testdata/pop2010/nozgeo.txt", Store: popfixture(t, [][2]int{{0, 3}, {4, 16}, {17, 22}}, 1), Ages: coarse},
+		{Year: 2020, GeoFile: "testdata/pop2010/nozgeo.txt", Store: popfixture(t, p12, 2)},
+	}}
+	if err := Pop(R, cfg); err != nil {
+		t.Fatal(err)
+	}
+	// get -- returns the response to the GET request `path`
+	get := func(path string, code int, result interface{}) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Fatalf("%s: status %d, expected %d", path, w.Code, code)
+		}
+		if result != nil {
+			if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+		}
+	}
+	//
+	var vintages struct {
+		Vintages []struct {
+			Vintage int      `json:"vintage"`
+			Ages    []string `json:"ages"`
+		} `json:"vintages"`
+	}
+	get("/api/pop/vintages", http.StatusOK, &vintages)
+	if v := vintages.Vintages; len(v) != 3 || v[0].Vintage != 2000 || v[1].Vintage != 2010 || v[2].Vintage != 2020 {
+		t.Fatalf("vintages: %+v", v)
+	}
+	if ages := strings.Join(vintages.Vintages[0].Ages, ","); ages != "under18,18to64,65over" {
+		t.Errorf("vintage 2000: ages %s", ages)
+	}
+	if ages := vintages.Vintages[2].Ages; len(ages) != len(PopAgesP12) || ages[0] != "under5" || ages[len(ages)-1] != "85over" {
+		t.Errorf("vintage 2020: ages %v", ages)
+	}
+	//
+	const query = "/20000/lat/39.97/lon/-105.03"
+	var v2010 vpopcount
+	get("/api/pop/2010"+query, http.StatusOK, &v2010)
+	if v2010.Pop == 0 || len(v2010.Fages) != len(PopAgesP12) {
+		t.Fatalf("vintage 2010: %+v", v2010)
+	}
+	type compare struct {
+		Vintage1 vpopcount `json:"vintage1"`
+		Vintage2 vpopcount `json:"vintage2"`
+		Change   struct {
+			Pop    int           `json:"pop"`
+			Fpop   int           `json:"pop_female"`
+			Mpop   int           `json:"pop_male"`
+			PopPct *float64      `json:"pop_percent"`
+			Fages  []popagecount `json:"ages_female"`
+			Mages  []popagecount `json:"ages_male"`
+			Fbands []popagecount `json:"agebands_female"`
+			Mbands []popagecount `json:"agebands_male"`
+		} `json:"change"`
+	}
+	// the same age buckets: the change is reported by age
+	var c compare
+	get("/api/pop/compare/2010/2020"+query, http.StatusOK, &c)
+	if c.Change.Pop != v2010.Pop || c.Change.Fpop != v2010.Fpop || c.Change.Mpop != v2010.Mpop || c.Change.PopPct == nil || *c.Change.PopPct != 100 {
+		t.Errorf("2010-2020: %+v", c.Change)
+	}
+	if len(c.Change.Fages) != len(PopAgesP12) || len(c.Change.Mages) != len(PopAgesP12) {
+		t.Fatalf("2010-2020: %d and %d age buckets", len(c.Change.Fages), len(c.Change.Mages))
+	}
+	for k := range PopAgesP12 {
+		if c.Change.Fages[k] != v2010.Fages[k] || c.Change.Mages[k] != v2010.Mages[k] {
+			t.Errorf("2010-2020: age %s: %+v %+v, expected %+v %+v", v2010.Fages[k].Age, c.Change.Fages[k], c.Change.Mages[k], v2010.Fages[k], v2010.Mages[k])
+		}
+	}
+	// different age buckets: the change by age is left out, the age bands of both vintages are compared
+	c = compare{}
+	get("/api/pop/compare/2000/2010"+query+"?ages=children:0-17,adults:18-64,seniors:65-", http.StatusOK, &c)
+	if c.Change.Pop != 0 || c.Change.PopPct == nil || *c.Change.PopPct != 0 || c.Change.Fages != nil || c.Change.Mages != nil {
+		t.Errorf("2000-2010: %+v", c.Change)
+	}
+	if len(c.Vintage1.Fages) != 3 || len(c.Vintage2.Fages) != len(PopAgesP12) {
+		t.Errorf("2000-2010: %d and %d age buckets", len(c.Vintage1.Fages), len(c.Vintage2.Fages))
+	}
+	if len(c.Change.Fbands) != 3 || len(c.Change.Mbands) != 3 {
+		t.Fatalf("2000-2010: %+v", c.Change)
+	}
+	for k, name := range []string{"children", "adults", "seniors"} {
+		fb, mb := c.Change.Fbands[k], c.Change.Mbands[k]
+		if fb != (popagecount{name, 0}) || mb != (popagecount{name, 0}) || c.Vintage1.Fbands[k] != c.Vintage2.Fbands[k] {
+			t.Errorf("2000-2010: band %s: %+v %+v", name, fb, mb)
+		}
+	}
+	// the age bands must match the age buckets of both vintages
+	get("/api/pop/compare/2000/2010"+query+"?ages=5y", http.StatusBadRequest, nil)
+	get("/api/pop/compare/2010/1990"+query, http.StatusBadRequest, nil)
+}
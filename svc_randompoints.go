@@ -24,12 +24,13 @@ func RandomPoints(R *mux.Router) {
 
 func usageRandomPoints(w http.ResponseWriter, r *http.Request) {
 	doc := `
-/api/randompoints/{count}/lat/{lat}/lon/{lon} -- returns {count} random points in a geographic cell [{lat},{lat}+1]x[{lon},{lon}+1].
+/api/randompoints/{count}/lat/{lat}/lon/{lon}[?format={format}] -- returns {count} random points in a geographic cell [{lat},{lat}+1]x[{lon},{lon}+1].
 
 Input:
 {count} = 1,...,1000
 {lat} = -90,...,89
 {lon} = -180,...,179
+{format} -- json (default) or geojson; also Accept: application/geo+json selects geojson
 
 Output:
 {
@@ -39,6 +40,9 @@ Output:
  "count":___,
  "points":[{"lat":___,"lon":___},...]
 }
+
+GeoJSON output:
+A Feature with the MultiPoint of the points and the properties "min", "max" and "count" as above.
 `
 	//
 	HS200t(w, []byte(doc))
@@ -75,6 +79,11 @@ func randomPoints(w http.ResponseWriter, r *http.Request) {
 		HS400(w)
 		return
 	}
+	geojson, err := parsegeojson(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
 	//
 	result := ons2.CellRnd1x1(int(lat), int(lon), int(count))
 	type latlon struct {
@@ -92,6 +101,25 @@ func randomPoints(w http.ResponseWriter, r *http.Request) {
 		lat, lon := p.Geo()
 		resultx.Points[k] = latlon{math.Round(lat*1e8) / 1e8, math.Round(lon*1e8) / 1e8}
 	}
+	if geojson {
+		points := make([]geolatlon, len(resultx.Points))
+		for k, p := range resultx.Points {
+			points[k] = geolatlon{p.Lat, p.Lon}
+		}
+		props := struct {
+			Min   latlon `json:"min"`
+			Max   latlon `json:"max"`
+			Count int64  `json:"count"`
+		}{resultx.Min, resultx.Max, resultx.Count}
+		resultj, err := json.Marshal(gjfeature{"Feature", gjmultipoint(points), props})
+		if err != nil {
+			HS500(w)
+			return
+		}
+		//
+		HS200geojson(w, resultj)
+		return
+	}
 	resultj, err := json.Marshal(resultx)
 	if err != nil {
 		HS500(w)
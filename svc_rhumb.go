@@ -0,0 +1,371 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Rhumb -- configures the service for the router `R`.
+func Rhumb(R *mux.Router) {
+	R.Handle("/api/rhumb", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(usageRhumb))).Methods("GET")
+	R.Handle("/api/rhumb/{count}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(rhumbcount))).Methods("GET")
+	R.Handle("/api/rhumb/step/{step}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(rhumbstep))).Methods("GET")
+	R.Handle("/api/rhumb/deviation/{deviation}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(rhumbdev))).Methods("GET")
+}
+
+func usageRhumb(w http.ResponseWriter, r *http.Request) {
+	doc := `
+/api/rhumb/{count}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}[?format={format}] -- generates a path along the rhumb line (loxodrome) of WGS1984
+between two given geographic locations. The rhumb line crosses all meridians at the same azimuth.
+
+Input:
+{count} = 3,...,1001 -- the number of points in the generated path
+{lat1} -- the geographic latitude of the source, must be in [-90,90]
+{lon1} -- the geographic longitude of the source, must be in [-180,180]
+{lat2} -- the geographic latitude of the target, must be in [-90,90]
+{lon2} -- the geographic longitude of the target, must be in [-180,180]
+{format} -- json (default) or geojson, as in /api/greatell
+
+Output:
+{
+ "duration_ms":___,
+ "type":"Rhumb",
+ "source":{"lat":___,"lon":___},
+ "target":{"lat":___,"lon":___},
+ "count":___,
+ "distance":___,
+ "step":___,
+ "azimuth":___,
+ "greatell_distance":___,
+ "excess":___,
+ "excess_percent":___,
+ "path":[{"lat":___,"lon":___,"azi":___},...]
+}
+
+{distance} -- the length of the rhumb line between the source and the target points in meters
+{step} -- the distance between two consecutive points on the path in meters
+{azimuth} -- the constant azimuth of the rhumb line; the shorter way around the globe is taken
+{greatell_distance} -- the distance between the source and the target along the great ellipse in meters
+{excess} -- how much longer the rhumb line is than the great ellipse in meters
+{excess_percent} -- the same as a percentage of the great ellipse distance
+
+GeoJSON output:
+A Feature with the LineString of the path (a MultiLineString if the path crosses the antimeridian)
+and the properties "type", "count", "distance", "step", "deviation", "azimuth", "greatell_distance",
+"excess" and "excess_percent" as above.
+
+/api/rhumb/step/{step}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}[?format={format}] -- as above, with a point every {step} meters.
+/api/rhumb/deviation/{deviation}/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}[?format={format}] -- as above, with the points evenly spaced
+and so dense that the path drawn as straight lines in the lat/lon plane deviates less than {deviation} meters from the rhumb line.
+
+Input and output:
+As in /api/greatell.
+`
+	//
+	HS200t(w, []byte(doc))
+}
+
+func rhumbcount(w http.ResponseWriter, r *http.Request) {
+	rhumb(w, r, "count")
+}
+
+func rhumbstep(w http.ResponseWriter, r *http.Request) {
+	rhumb(w, r, "step")
+}
+
+func rhumbdev(w http.ResponseWriter, r *http.Request) {
+	rhumb(w, r, "deviation")
+}
+
+func rhumb(w http.ResponseWriter, r *http.Request, mode string) {
+	start := time.Now()
+	vars := mux.Vars(r)
+	//
+	var gs gesampling
+	switch mode {
+	case "count":
+		count, err := strconv.ParseInt(vars["count"], 10, 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		if !(3 <= count && count <= 1001) {
+			HS400(w)
+			return
+		}
+		gs.count = int(count)
+	case "step":
+		step, err := strconv.ParseFloat(vars["step"], 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		if !(1 <= step && step <= 20000000) {
+			HS400(w)
+			return
+		}
+		gs.step = step
+	case "deviation":
+		deviation, err := strconv.ParseFloat(vars["deviation"], 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		if !(0.01 <= deviation && deviation <= 100000) {
+			HS400(w)
+			return
+		}
+		gs.deviation = deviation
+	}
+	//
+	lat1, err := strconv.ParseFloat(vars["lat1"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat1 && lat1 <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon1, err := strconv.ParseFloat(vars["lon1"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon1 && lon1 <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	lat2, err := strconv.ParseFloat(vars["lat2"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-90 <= lat2 && lat2 <= 90) {
+		HS400(w)
+		return
+	}
+	//
+	lon2, err := strconv.ParseFloat(vars["lon2"], 64)
+	if err != nil {
+		HS400(w)
+		return
+	}
+	if !(-180 <= lon2 && lon2 <= 180) {
+		HS400(w)
+		return
+	}
+	//
+	geojson, err := parsegeojson(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	type geo2 struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	type geo3 struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+		Azi float64 `json:"azi"`
+	}
+	type geopath []geo3
+	//
+	source, target := geomys.Geo(lat1, lon1), geomys.Geo(lat2, lon2)
+	seg := newrhumbseg(source, target)
+	sam, ok := gs.apply(&seg, 1001)
+	if !ok {
+		HS400t(w, "too many points")
+		return
+	}
+	result := make(geopath, len(sam.points))
+	for k, loc := range sam.points {
+		t1, t2 := loc.Geo()
+		result[k] = geo3{math.Round(t1*1e8) / 1e8, math.Round(t2*1e8) / 1e8, math.Round(sam.azis[k]*1e8) / 1e8}
+	}
+	var deviation *float64
+	if mode == "deviation" {
+		d := math.Round(sam.deviation*1e3) / 1e3
+		deviation = &d
+	}
+	//
+	ge, _, _ := geonavs["greatellipse"].inverse(source, target)
+	excess := math.Max(0, seg.s12-ge)
+	percent := 0.0
+	if ge > 0 {
+		percent = excess / ge * 100
+	}
+	//
+	if geojson {
+		line := make([]geolatlon, len(result))
+		for k, p := range result {
+			line[k] = geolatlon{p.Lat, p.Lon}
+		}
+		props := struct {
+			Type      string   `json:"type"`
+			Count     int      `json:"count"`
+			Distance  float64  `json:"distance"`
+			Step      float64  `json:"step"`
+			Deviation *float64 `json:"deviation,omitempty"`
+			Azimuth   float64  `json:"azimuth"`
+			GEDist    float64  `json:"greatell_distance"`
+			Excess    float64  `json:"excess"`
+			ExcessPct float64  `json:"excess_percent"`
+		}{"Rhumb", len(result), math.Round(seg.s12*1e3) / 1e3, math.Round(sam.step*1e3) / 1e3, deviation, math.Round(seg.azi1*1e8) / 1e8, math.Round(ge*1e3) / 1e3, math.Round(excess*1e3) / 1e3, math.Round(percent*1e4) / 1e4}
+		//
+		jresult, err := json.Marshal(gjfeature{"Feature", gjline(line), props})
+		if err != nil {
+			HS500(w)
+			return
+		}
+		//
+		HS200geojson(w, jresult)
+		return
+	}
+	//
+	resultx := struct {
+		Duration  int64    `json:"duration_ms"`
+		Type      string   `json:"type"`
+		Source    geo2     `json:"source"`
+		Target    geo2     `json:"target"`
+		Count     int      `json:"count"`
+		Distance  float64  `json:"distance"`
+		Step      float64  `json:"step"`
+		Deviation *float64 `json:"deviation,omitempty"`
+		Azimuth   float64  `json:"azimuth"`
+		GEDist    float64  `json:"greatell_distance"`
+		Excess    float64  `json:"excess"`
+		ExcessPct float64  `json:"excess_percent"`
+		Path      geopath  `json:"path"`
+	}{time.Since(start).Milliseconds(), "Rhumb", geo2{result[0].Lat, result[0].Lon}, geo2{result[len(result)-1].Lat, result[len(result)-1].Lon}, len(result), math.Round(seg.s12*1e3) / 1e3, math.Round(sam.step*1e3) / 1e3, deviation, math.Round(seg.azi1*1e8) / 1e8, math.Round(ge*1e3) / 1e3, math.Round(excess*1e3) / 1e3, math.Round(percent*1e4) / 1e4, result}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+// newrhumbseg -- the rhumb line from `source` to `target` as a segment.
+// The azimuth is the same at every point of the segment.
+func newrhumbseg(source, target geomys.Point) geseg {
+	lat1, lon1 := source.Geo()
+	lat2, lon2 := target.Geo()
+	s12, azi := rhumbinverse(lat1, lon1, lat2, lon2)
+	direct := func(p geomys.Point, azi, s float64) (geomys.Point, float64) {
+		lat, lon := p.Geo()
+		if math.Abs(lat) == 90 {
+			// from a pole the rhumb line is the meridian of the target
+			lon = lon2
+		}
+		lat, lon = rhumbdirect(lat, lon, azi, s)
+		return geomys.Geo(lat, lon), azi
+	}
+	return geseg{source, target, s12, azi, azi, direct}
+}
+
+// rhumbinverse -- returns the length and the azimuth of the rhumb line from (lat1,lon1) to (lat2,lon2).
+// The rhumb line is a straight line in the Mercator projection: tan(azi) = Δλ/Δψ,
+// and its length is ΔM/cos(azi), where ψ is the isometric latitude and M is the meridian arc.
+func rhumbinverse(lat1, lon1, lat2, lon2 float64) (s12, azi float64) {
+	const d2r = math.Pi / 180
+	φ1, φ2 := lat1*d2r, lat2*d2r
+	ΔM := meridarc(φ2) - meridarc(φ1)
+	if math.Abs(lat1) == 90 || math.Abs(lat2) == 90 {
+		// along a meridian
+		if ΔM < 0 {
+			return -ΔM, 180
+		}
+		return ΔM, 0
+	}
+	Δλ := math.Remainder(lon2-lon1, 360) * d2r
+	Δψ := isolat(φ2) - isolat(φ1)
+	azi = math.Atan2(Δλ, Δψ) / d2r
+	s12 = math.Hypot(Δλ, Δψ) * rhumbratio(φ1, φ2, ΔM, Δψ)
+	return
+}
+
+// rhumbdirect -- returns the point at the distance `s` from (lat1,lon1) along the rhumb line of the azimuth `azi`.
+// The rhumb line stops at a pole.
+func rhumbdirect(lat1, lon1, azi, s float64) (lat2, lon2 float64) {
+	const d2r = math.Pi / 180
+	sα, cα := math.Sincos(azi * d2r)
+	φ1 := lat1 * d2r
+	φ2 := meridinv(meridarc(φ1) + s*cα)
+	Δλ := 0.0
+	if math.Abs(lat1) != 90 && math.Abs(φ2) != math.Pi/2 {
+		ΔM := meridarc(φ2) - meridarc(φ1)
+		Δψ := isolat(φ2) - isolat(φ1)
+		Δλ = s * sα / rhumbratio(φ1, φ2, ΔM, Δψ)
+	}
+	return φ2 / d2r, math.Remainder(lon1+Δλ/d2r, 360)
+}
+
+// rhumbratio -- returns ΔM/Δψ between the latitudes φ1 and φ2 (radians).
+// Near a parallel this is the radius of the parallel at the mean latitude.
+func rhumbratio(φ1, φ2, ΔM, Δψ float64) float64 {
+	if math.Abs(φ2-φ1) < 1e-6 {
+		s, c := math.Sincos((φ1 + φ2) / 2)
+		return wgsA * c / math.Sqrt(1-wgsE2*s*s)
+	}
+	return ΔM / Δψ
+}
+
+// isolat -- returns the isometric latitude of the geographic latitude φ (radians).
+func isolat(φ float64) float64 {
+	e := math.Sqrt(wgsE2)
+	s := math.Sin(φ)
+	return math.Atanh(s) - e*math.Atanh(e*s)
+}
+
+// meridarc -- returns the length of the meridian arc from the equator to the latitude φ (radians)
+// (Helmert's series in the third flattening n).
+func meridarc(φ float64) float64 {
+	const n = wgsF / (2 - wgsF)
+	const n2 = n * n
+	return wgsA / (1 + n) * ((1+n2/4+n2*n2/64)*φ -
+		(3*n/2-3*n*n2/16)*math.Sin(2*φ) +
+		(15*n2/16-15*n2*n2/64)*math.Sin(4*φ) -
+		(35*n*n2/48)*math.Sin(6*φ) +
+		(315*n2*n2/512)*math.Sin(8*φ))
+}
+
+// meridinv -- returns the latitude (radians) of the meridian arc of the length `m` (Newton's method).
+// The latitude is clamped to the poles.
+func meridinv(m float64) float64 {
+	q := meridarc(math.Pi / 2)
+	if m >= q {
+		return math.Pi / 2
+	}
+	if m <= -q {
+		return -math.Pi / 2
+	}
+	φ := m / q * math.Pi / 2
+	for i := 0; i < 10; i++ {
+		s := math.Sin(φ)
+		w := 1 - wgsE2*s*s
+		δ := (meridarc(φ) - m) / (wgsA * (1 - wgsE2) / (w * math.Sqrt(w)))
+		φ -= δ
+		if math.Abs(δ) < 1e-15 {
+			break
+		}
+	}
+	return φ
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMeridArc(t *testing.T) {
+	// the quarter meridian of WGS1984
+	if q := meridarc(math.Pi / 2); math.Abs(q-10001965.7293) > 1e-3 {
+		t.Errorf("quarter meridian: %.4f", q)
+	}
+	for _, lat := range []float64{-89.9, -60, -10, 0, 0.001, 45, 80, 90} {
+		φ := lat * math.Pi / 180
+		if got := meridinv(meridarc(φ)); math.Abs(got-φ) > 1e-12 {
+			t.Errorf("meridinv(meridarc(%v)) = %v", lat, got*180/math.Pi)
+		}
+		// the meridian arc is the geodesic along the meridian
+		s, _, _ := wgsgeodesic.inverse(0, 0, lat, 0)
+		if m := math.Abs(meridarc(φ)); math.Abs(m-s) > 1e-6 {
+			t.Errorf("meridarc(%v) = %.6f, geodesic %.6f", lat, m, s)
+		}
+	}
+}
+
+func TestRhumbInverse(t *testing.T) {
+	const d2r = math.Pi / 180
+	// parallel -- the length of the parallel at `lat` between two meridians `Δlon` apart
+	parallel := func(lat, Δlon float64) float64 {
+		s, c := math.Sincos(lat * d2r)
+		return wgsA * c / math.Sqrt(1-wgsE2*s*s) * Δlon * d2r
+	}
+	tests := []struct {
+		lat1, lon1, lat2, lon2 float64
+		s12, azi               float64
+	}{
+		{0, 0, 0, 90, wgsA * math.Pi / 2, 90},
+		{0, 90, 0, 0, wgsA * math.Pi / 2, -90},
+		{10, 170, 10, -170, parallel(10, 20), 90},
+		{-10, -170, -10, 170, parallel(10, 20), -90},
+		{0, 30, 60, 30, meridarc(60 * d2r), 0},
+		{80, -45, -90, 0, meridarc(80*d2r) + meridarc(90*d2r), 180},
+	}
+	for _, tt := range tests {
+		s12, azi := rhumbinverse(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+		if math.Abs(s12-tt.s12) > 1e-6 || math.Abs(azi-tt.azi) > 1e-12 {
+			t.Errorf("(%v,%v)->(%v,%v): %.6f %v, expected %.6f %v", tt.lat1, tt.lon1, tt.lat2, tt.lon2, s12, azi, tt.s12, tt.azi)
+		}
+	}
+}
+
+func TestRhumbDirect(t *testing.T) {
+	for _, c := range [][4]float64{
+		{40.64, -73.78, 51.47, -0.46},
+		{-33.9, 18.4, 35.7, 139.7},
+		{60, -10, -60, 120},
+		{10, 170, 20, -170},
+		{10, 10, 10.0000001, 20},
+		{-89, 0, 89, 179},
+	} {
+		s12, azi := rhumbinverse(c[0], c[1], c[2], c[3])
+		lat, lon := rhumbdirect(c[0], c[1], azi, s12)
+		if math.Abs(lat-c[2]) > 1e-9 || math.Abs(math.Remainder(lon-c[3], 360)) > 1e-9 {
+			t.Errorf("%v: the direct problem ends at (%v,%v)", c, lat, lon)
+		}
+		// the azimuth is the same at every point of the rhumb line
+		for _, f := range []float64{0.25, 0.5, 0.75} {
+			lat, lon := rhumbdirect(c[0], c[1], azi, f*s12)
+			s, a := rhumbinverse(lat, lon, c[2], c[3])
+			if math.Abs(s-(1-f)*s12) > 1e-6 || math.Abs(a-azi) > 1e-6 {
+				t.Errorf("%v: at %v the rest is %.6f m at %v, expected %.6f m at %v", c, f, s, a, (1-f)*s12, azi)
+			}
+		}
+	}
+	// the rhumb line stops at a pole
+	for _, tt := range [][3]float64{{80, 30, 90}, {-80, 150, -90}} {
+		azi := 30.0
+		if tt[2] < 0 {
+			azi = 150
+		}
+		if lat, _ := rhumbdirect(tt[0], tt[1], azi, 5000000); lat != tt[2] {
+			t.Errorf("(%v,%v) azimuth %v: latitude %v, expected %v", tt[0], tt[1], azi, lat, tt[2])
+		}
+	}
+	// from a pole the rhumb line segment follows the meridian of the target
+	g := newrhumbseg(geomys.Geo(90, 0), geomys.Geo(60, 50))
+	ps, _ := g.sample(5)
+	for _, p := range ps[1:] {
+		if _, lon := p.Geo(); math.Abs(lon-50) > 1e-9 {
+			t.Errorf("from the north pole: longitude %v, expected 50", lon)
+		}
+	}
+}
+
+func TestRhumbService(t *testing.T) {
+	R := mux.NewRouter()
+	Rhumb(R)
+	tests := []struct {
+		path  string
+		code  int
+		count int
+	}{
+		{"/api/rhumb/5/lat1/40.64/lon1/-73.78/lat2/51.47/lon2/-0.46", http.StatusOK, 5},
+		{"/api/rhumb/step/1000000/lat1/40.64/lon1/-73.78/lat2/51.47/lon2/-0.46", http.StatusOK, 7},
+		{"/api/rhumb/deviation/100/lat1/10/lon1/170/lat2/20/lon2/-170", http.StatusOK, 0},
+		{"/api/rhumb/3/lat1/1/lon1/1/lat2/91/lon2/1", http.StatusBadRequest, 0},
+		{"/api/rhumb/2/lat1/1/lon1/1/lat2/2/lon2/1", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, expected %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var result struct {
+			Type     string  `json:"type"`
+			Count    int     `json:"count"`
+			Distance float64 `json:"distance"`
+			Azimuth  float64 `json:"azimuth"`
+			GEDist   float64 `json:"greatell_distance"`
+			Excess   float64 `json:"excess"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Type != "Rhumb" || tt.count != 0 && result.Count != tt.count {
+			t.Errorf("%s: %+v", tt.path, result)
+		}
+		// the rhumb line is never shorter than the great ellipse
+		if result.Excess < 0 || math.Abs(result.Distance-result.GEDist-result.Excess) > 0.01 {
+			t.Errorf("%s: %+v", tt.path, result)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Track -- configures the service for the router `R`.
+func Track(R *mux.Router) {
+	R.Handle("/api/track", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(usageTrack))).Methods("GET")
+	R.Handle("/api/track/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}/lat/{lat}/lon/{lon}", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(track))).Methods("GET")
+	R.Handle("/api/track/route", handlers.LoggingHandler(os.Stderr, http.HandlerFunc(trackroute))).Methods("POST")
+}
+
+func usageTrack(w http.ResponseWriter, r *http.Request) {
+	doc := `
+/api/track/lat1/{lat1}/lon1/{lon1}/lat2/{lat2}/lon2/{lon2}/lat/{lat}/lon/{lon}[?method={method}] -- returns the cross-track
+and the along-track distances from a given geographic location to the path between two given geographic locations.
+
+Input:
+{lat1} -- the geographic latitude of the source, must be in [-90,90]
+{lon1} -- the geographic longitude of the source, must be in [-180,180]
+{lat2} -- the geographic latitude of the target, must be in [-90,90]
+{lon2} -- the geographic longitude of the target, must be in [-180,180]
+{lat} -- the geographic latitude of the location, must be in [-90,90]
+{lon} -- the geographic longitude of the location, must be in [-180,180]
+{method} -- greatellipse (default), geodesic, haversine or andoyer, as in /api/greatell
+
+Output:
+{
+ "duration_ms":___,
+ "method":___,
+ "point":{"lat":___,"lon":___},
+ "distance":___,
+ "foot":{"lat":___,"lon":___},
+ "azi":___,
+ "cross_track":___,
+ "along_track":___
+}
+
+{distance} -- the length of the path in meters
+{foot} -- the point of the path closest to the location (the foot point);
+          it is an endpoint of the path if the location is not abeam of the path
+{azi} -- the azimuth of the path at the foot point
+{cross_track} -- the distance from the foot point to the location in meters,
+                 positive if the location is to the right of the path and negative if to the left
+{along_track} -- the distance from the source to the foot point along the path in meters
+
+/api/track/route[?method={method}] -- (POST) returns the cross-track and the along-track distances from a given geographic location
+to the path through the given waypoints.
+
+Input:
+{
+ "point":{"lat":___,"lon":___},
+ "waypoints":[{"lat":___,"lon":___},...]
+}
+
+{point} -- the geographic location
+{waypoints} -- 2,...,100 geographic locations in the order of the route
+
+Output:
+{
+ "duration_ms":___,
+ "method":___,
+ "point":{"lat":___,"lon":___},
+ "leg_count":___,
+ "length":___,
+ "leg":___,
+ "foot":{"lat":___,"lon":___},
+ "azi":___,
+ "cross_track":___,
+ "along_track":___,
+ "leg_along_track":___
+}
+
+{leg_count} -- the number of legs
+{length} -- the length of the route in meters
+{leg} -- the leg closest to the location (0 is the leg from the first waypoint to the second one)
+{along_track} -- the distance from the start of the route to the foot point along the route in meters
+{leg_along_track} -- the distance from the start of the leg to the foot point in meters
+The other values are as above for the closest leg.
+`
+	//
+	HS200t(w, []byte(doc))
+}
+
+// trackfoot -- the foot point of a location on a segment.
+type trackfoot struct {
+	foot geomys.Point
+	s    float64 // along-track
+	d    float64 // cross-track, positive to the right
+	azi  float64 // the azimuth of the segment at the foot point
+}
+
+// track -- returns the foot point of `p` on the segment `g`, with the distances by the method `nav`.
+// The segment is sampled, and the distance to `p` is minimized around the closest sample.
+func (g *geseg) track(nav geonav, p geomys.Point) trackfoot {
+	const SMIN = 17
+	const SMAX = 401
+	const H = 100000
+	count := int(math.Ceil(g.s12/H)) + 1
+	if count < SMIN {
+		count = SMIN
+	}
+	if count > SMAX {
+		count = SMAX
+	}
+	step := g.s12 / float64(count-1)
+	points, _ := g.sample(count)
+	dist := func(q geomys.Point) float64 {
+		s12, _, _ := nav.inverse(q, p)
+		return s12
+	}
+	best, bestd := 0, math.Inf(1)
+	for j, q := range points {
+		if d := dist(q); d < bestd {
+			best, bestd = j, d
+		}
+	}
+	a := math.Max(0, float64(best-1)*step)
+	b := math.Min(g.s12, float64(best+1)*step)
+	s, d := goldenmin(func(s float64) float64 {
+		q, _ := g.at(s)
+		return dist(q)
+	}, a, b, 0.001)
+	foot, azi := g.at(s)
+	// the ends of the segment are not reached by the search
+	if d0 := dist(g.source); d0 <= d {
+		s, d, foot, azi = 0, d0, g.source, g.azi1
+	}
+	if d1 := dist(g.target); d1 < d {
+		s, d, foot, azi = g.s12, d1, g.target, g.azi2
+	}
+	if d > 0 {
+		_, azip, _ := nav.inverse(foot, p)
+		if math.Sin((azip-azi)*math.Pi/180) < 0 {
+			d = -d
+		}
+	}
+	return trackfoot{foot, s, d, azi}
+}
+
+func track(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	vars := mux.Vars(r)
+	//
+	var coords [6]float64
+	for k, name := range []string{"lat1", "lon1", "lat2", "lon2", "lat", "lon"} {
+		x, err := strconv.ParseFloat(vars[name], 64)
+		if err != nil {
+			HS400(w)
+			return
+		}
+		lim := 90.0
+		if k%2 == 1 {
+			lim = 180
+		}
+		if !(-lim <= x && x <= lim) {
+			HS400(w)
+			return
+		}
+		coords[k] = x
+	}
+	//
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	seg := newgeseg(nav, geomys.Geo(coords[0], coords[1]), geomys.Geo(coords[2], coords[3]))
+	tf := seg.track(nav, geomys.Geo(coords[4], coords[5]))
+	flat, flon := tf.foot.Geo()
+	//
+	resultx := struct {
+		Duration   int64     `json:"duration_ms"`
+		Method     string    `json:"method"`
+		Point      geolatlon `json:"point"`
+		Distance   float64   `json:"distance"`
+		Foot       geolatlon `json:"foot"`
+		Azi        float64   `json:"azi"`
+		CrossTrack float64   `json:"cross_track"`
+		AlongTrack float64   `json:"along_track"`
+	}{time.Since(start).Milliseconds(), nav.name, geolatlon{coords[4], coords[5]}, math.Round(seg.s12*1e3) / 1e3, geolatlon{math.Round(flat*1e8) / 1e8, math.Round(flon*1e8) / 1e8}, math.Round(tf.azi*1e8) / 1e8, math.Round(tf.d*1e3) / 1e3, math.Round(tf.s*1e3) / 1e3}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
+
+func trackroute(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const NMAX = 100
+	//
+	var t struct {
+		Point     *geolatlon  `json:"point"`
+		Waypoints []geolatlon `json:"waypoints"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&t)
+	if err != nil {
+		// JSON error
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	if t.Point == nil {
+		HS400t(w, "point must be given")
+		return
+	}
+	n := len(t.Waypoints)
+	if n < 2 || n > NMAX {
+		// array length error
+		HS400t(w, "array length error")
+		return
+	}
+	for _, p := range t.Waypoints {
+		if !(-90 <= p.Lat && p.Lat <= 90 && -180 <= p.Lon && p.Lon <= 180) {
+			HS400t(w, "coordinate error")
+			return
+		}
+	}
+	if !(-90 <= t.Point.Lat && t.Point.Lat <= 90 && -180 <= t.Point.Lon && t.Point.Lon <= 180) {
+		HS400t(w, "coordinate error")
+		return
+	}
+	//
+	nav, err := parsegeonav(r)
+	if err != nil {
+		HS400t(w, err.Error())
+		return
+	}
+	//
+	p := geomys.Geo(t.Point.Lat, t.Point.Lon)
+	length := 0.0
+	leg, legstart := -1, 0.0
+	var best trackfoot
+	for i := 0; i < n-1; i++ {
+		p1, p2 := t.Waypoints[i], t.Waypoints[i+1]
+		seg := newgeseg(nav, geomys.Geo(p1.Lat, p1.Lon), geomys.Geo(p2.Lat, p2.Lon))
+		tf := seg.track(nav, p)
+		if leg < 0 || math.Abs(tf.d) < math.Abs(best.d) {
+			leg, legstart, best = i, length, tf
+		}
+		length += seg.s12
+	}
+	flat, flon := best.foot.Geo()
+	//
+	resultx := struct {
+		Duration      int64     `json:"duration_ms"`
+		Method        string    `json:"method"`
+		Point         geolatlon `json:"point"`
+		LegCount      int       `json:"leg_count"`
+		Length        float64   `json:"length"`
+		Leg           int       `json:"leg"`
+		Foot          geolatlon `json:"foot"`
+		Azi           float64   `json:"azi"`
+		CrossTrack    float64   `json:"cross_track"`
+		AlongTrack    float64   `json:"along_track"`
+		LegAlongTrack float64   `json:"leg_along_track"`
+	}{time.Since(start).Milliseconds(), nav.name, *t.Point, n - 1, math.Round(length*1e3) / 1e3, leg, geolatlon{math.Round(flat*1e8) / 1e8, math.Round(flon*1e8) / 1e8}, math.Round(best.azi*1e8) / 1e8, math.Round(best.d*1e3) / 1e3, math.Round((legstart+best.s)*1e3) / 1e3, math.Round(best.s*1e3) / 1e3}
+	//
+	jresult, err := json.Marshal(resultx)
+	if err != nil {
+		HS500(w)
+		return
+	}
+	//
+	HS200j(w, jresult)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2019-2021 Leonid Kneller. All rights reserved.
+// Licensed under the MIT license.
+// See the LICENSE file for full license information.
+
+package svc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/reconditematter/geomys"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeSegTrack(t *testing.T) {
+	for name, nav := range geonavs {
+		tests := []struct {
+			p1, p2, p, foot geolatlon
+			right           bool
+		}{
+			// eastbound along the equator: north is to the left
+			{geolatlon{0, -10}, geolatlon{0, 10}, geolatlon{1, 3}, geolatlon{0, 3}, false},
+			{geolatlon{0, -10}, geolatlon{0, 10}, geolatlon{-1, 3}, geolatlon{0, 3}, true},
+			// westbound along the equator: north is to the right
+			{geolatlon{0, 10}, geolatlon{0, -10}, geolatlon{1, 3}, geolatlon{0, 3}, true},
+			// across the antimeridian
+			{geolatlon{0, 170}, geolatlon{0, -170}, geolatlon{-2, 179}, geolatlon{0, 179}, true},
+			// not abeam: the foot point is an endpoint
+			{geolatlon{0, -10}, geolatlon{0, 10}, geolatlon{1, 13}, geolatlon{0, 10}, false},
+			{geolatlon{0, -10}, geolatlon{0, 10}, geolatlon{-1, -13}, geolatlon{0, -10}, true},
+		}
+		for _, tt := range tests {
+			source, target := geomys.Geo(tt.p1.Lat, tt.p1.Lon), geomys.Geo(tt.p2.Lat, tt.p2.Lon)
+			p, foot := geomys.Geo(tt.p.Lat, tt.p.Lon), geomys.Geo(tt.foot.Lat, tt.foot.Lon)
+			seg := newgeseg(nav, source, target)
+			tf := seg.track(nav, p)
+			flat, flon := tf.foot.Geo()
+			if math.Abs(flat-tt.foot.Lat) > 1e-6 || math.Abs(math.Remainder(flon-tt.foot.Lon, 360)) > 1e-6 {
+				t.Errorf("%s: %+v: the foot point is (%v,%v), expected %+v", name, tt, flat, flon, tt.foot)
+				continue
+			}
+			s, _, _ := nav.inverse(source, foot)
+			d, _, _ := nav.inverse(foot, p)
+			if !tt.right {
+				d = -d
+			}
+			if math.Abs(tf.s-s) > 0.01 || math.Abs(tf.d-d) > 0.01 {
+				t.Errorf("%s: %+v: along-track %.3f, cross-track %.3f, expected %.3f, %.3f", name, tt, tf.s, tf.d, s, d)
+			}
+		}
+		// northbound along a meridian: east is to the right
+		seg := newgeseg(nav, geomys.Geo(0, 0), geomys.Geo(10, 0))
+		if tf := seg.track(nav, geomys.Geo(5, 1)); !(tf.d > 0) || math.Abs(tf.azi) > 1e-6 {
+			t.Errorf("%s: northbound: cross-track %v, azimuth %v", name, tf.d, tf.azi)
+		}
+		if tf := seg.track(nav, geomys.Geo(5, -1)); !(tf.d < 0) {
+			t.Errorf("%s: northbound: cross-track %v", name, tf.d)
+		}
+	}
+}
+
+func TestTrackRoute(t *testing.T) {
+	R := mux.NewRouter()
+	Track(R)
+	tests := []struct {
+		body  string
+		code  int
+		leg   int
+		right bool
+	}{
+		{`{"point":{"lat":1,"lon":3},"waypoints":[{"lat":0,"lon":-10},{"lat":0,"lon":10},{"lat":10,"lon":10}]}`, http.StatusOK, 0, false},
+		{`{"point":{"lat":5,"lon":11},"waypoints":[{"lat":0,"lon":-10},{"lat":0,"lon":10},{"lat":10,"lon":10}]}`, http.StatusOK, 1, true},
+		{`{"point":{"lat":5,"lon":9},"waypoints":[{"lat":0,"lon":-10},{"lat":0,"lon":10},{"lat":10,"lon":10}]}`, http.StatusOK, 1, false},
+		{`{"waypoints":[{"lat":0,"lon":-10},{"lat":0,"lon":10}]}`, http.StatusBadRequest, 0, false},
+		{`{"point":{"lat":1,"lon":3},"waypoints":[{"lat":0,"lon":-10}]}`, http.StatusBadRequest, 0, false},
+		// the body is limited to the size of 100 waypoints
+		{`{"point":{"lat":1,"lon":3},"waypoints":[{"lat":0,"lon":-10},{"lat":0,"lon":10}` + strings.Repeat(" ", 1<<16) + `]}`, http.StatusBadRequest, 0, false},
+	}
+	nav := geonavs["greatellipse"]
+	leg0, _, _ := nav.inverse(geomys.Geo(0, -10), geomys.Geo(0, 10))
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		R.ServeHTTP(w, httptest.NewRequest("POST", "/api/track/route", strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%.80s: status %d, expected %d", tt.body, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var result struct {
+			LegCount      int     `json:"leg_count"`
+			Leg           int     `json:"leg"`
+			CrossTrack    float64 `json:"cross_track"`
+			AlongTrack    float64 `json:"along_track"`
+			LegAlongTrack float64 `json:"leg_along_track"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.LegCount != 2 || result.Leg != tt.leg || (result.CrossTrack > 0) != tt.right {
+			t.Errorf("%s: %+v", tt.body, result)
+		}
+		// the along-track distance of the route includes the legs before the closest one
+		if math.Abs(result.AlongTrack-result.LegAlongTrack-float64(tt.leg)*leg0) > 0.01 {
+			t.Errorf("%s: %+v", tt.body, result)
+		}
+	}
+}